@@ -7,12 +7,15 @@
 package diff
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
 	corefs "github.com/rcarmo/go-busybox/pkg/core/fs"
@@ -49,8 +52,8 @@ type hunk struct {
 //
 // Supported flags:
 //
-//	-u          Unified output format (default)
-//	-U N        Number of context lines (default 3)
+//	-u          Unified output format (default), 3 lines of context
+//	-U N        Unified output with N lines of context
 //	-r          Recursively compare directories
 //	-N          Treat absent files as empty
 //	-q          Report only whether files differ
@@ -332,6 +335,20 @@ func diffDir(stdio *core.Stdio, left string, right string, opts diffOptions, con
 			walkErr = err
 			continue
 		}
+		if skipped := irregularPath(leftPath, leftInfo, rightPath, rightInfo); skipped != "" {
+			stdio.Printf("File %s is not a regular file or directory and was skipped\n", skipped)
+			changed = true
+			continue
+		}
+		if leftInfo.IsDir() != rightInfo.IsDir() {
+			if leftInfo.IsDir() {
+				stdio.Printf("File %s is a directory while file %s is a regular file\n", leftPath, rightPath)
+			} else {
+				stdio.Printf("File %s is a regular file while file %s is a directory\n", leftPath, rightPath)
+			}
+			changed = true
+			continue
+		}
 		if leftInfo.IsDir() || rightInfo.IsDir() {
 			matched, _, err := diffDirOrFile(stdio, leftPath, rightPath, leftInfo.IsDir(), rightInfo.IsDir(), opts, contextLines)
 			if matched {
@@ -359,7 +376,34 @@ func diffDir(stdio *core.Stdio, left string, right string, opts diffOptions, con
 	return changed, core.ExitSuccess, nil
 }
 
+// irregularPath returns whichever of the two paths is neither a regular
+// file nor a directory, or "" when both can be compared.
+func irregularPath(leftPath string, leftInfo fs.FileInfo, rightPath string, rightInfo fs.FileInfo) string {
+	if !leftInfo.IsDir() && !leftInfo.Mode().IsRegular() {
+		return leftPath
+	}
+	if !rightInfo.IsDir() && !rightInfo.Mode().IsRegular() {
+		return rightPath
+	}
+	return ""
+}
+
 func diffFile(stdio *core.Stdio, left string, right string, opts diffOptions, contextLines int) (bool, int, error) {
+	if opts.brief && !opts.ignoreBlank {
+		differ, err := filesDiffer(left, right, opts)
+		if err != nil {
+			stdio.Errorf("diff: %v\n", err)
+			return false, core.ExitUsage, err
+		}
+		if differ {
+			stdio.Printf("Files %s and %s differ\n", left, right)
+			return true, core.ExitSuccess, nil
+		}
+		if opts.same {
+			stdio.Printf("Files %s and %s are identical\n", left, right)
+		}
+		return false, core.ExitSuccess, nil
+	}
 	leftData, err := corefs.ReadFile(left)
 	if err != nil {
 		stdio.Errorf("diff: %s: %v\n", left, err)
@@ -373,6 +417,45 @@ func diffFile(stdio *core.Stdio, left string, right string, opts diffOptions, co
 	return diffData(stdio, leftData, rightData, left, right, opts, contextLines)
 }
 
+// filesDiffer compares two files line by line under the active ignore
+// options, stopping at the first difference so -q need not read either
+// file to the end.
+func filesDiffer(left string, right string, opts diffOptions) (bool, error) {
+	lf, err := corefs.Open(left)
+	if err != nil {
+		return false, err
+	}
+	defer lf.Close()
+	rf, err := corefs.Open(right)
+	if err != nil {
+		return false, err
+	}
+	defer rf.Close()
+	normalize := opts.ignoreSpaceAmount || opts.ignoreAllSpace || opts.ignoreCase
+	lr := bufio.NewReader(lf)
+	rr := bufio.NewReader(rf)
+	for {
+		lline, lerr := lr.ReadString('\n')
+		rline, rerr := rr.ReadString('\n')
+		if lerr != nil && lerr != io.EOF {
+			return false, lerr
+		}
+		if rerr != nil && rerr != io.EOF {
+			return false, rerr
+		}
+		if normalize {
+			lline = normalizeLine(strings.TrimSuffix(lline, "\n"), opts)
+			rline = normalizeLine(strings.TrimSuffix(rline, "\n"), opts)
+		}
+		if lline != rline || (lerr == io.EOF) != (rerr == io.EOF) {
+			return true, nil
+		}
+		if lerr == io.EOF {
+			return false, nil
+		}
+	}
+}
+
 func diffData(stdio *core.Stdio, leftData []byte, rightData []byte, left string, right string, opts diffOptions, contextLines int) (bool, int, error) {
 	if bytes.Equal(leftData, rightData) {
 		if opts.same {
@@ -413,14 +496,8 @@ func diffData(stdio *core.Stdio, leftData []byte, rightData []byte, left string,
 		rightNorm, rightMap := normalizeLinesWithMap(rightOrig, opts)
 		lines = buildDiffLinesWithOriginal(leftOrig, rightOrig, leftNorm, rightNorm, leftMap, rightMap)
 	}
-	leftLabel := left
-	rightLabel := right
-	if opts.labelLeft != "" {
-		leftLabel = opts.labelLeft
-	}
-	if opts.labelRight != "" {
-		rightLabel = opts.labelRight
-	}
+	leftLabel := headerLabel(left, opts.labelLeft)
+	rightLabel := headerLabel(right, opts.labelRight)
 	// Detect "no newline at end of file"
 	leftNoNewline := len(leftData) > 0 && leftData[len(leftData)-1] != '\n'
 	rightNoNewline := len(rightData) > 0 && rightData[len(rightData)-1] != '\n'
@@ -452,18 +529,34 @@ func diffMissingFile(stdio *core.Stdio, left string, right string, leftErr error
 	leftNorm, leftMap := normalizeLinesWithMap(leftLines, opts)
 	rightNorm, rightMap := normalizeLinesWithMap(rightLines, opts)
 	lines := buildDiffLinesWithOriginal(leftLines, rightLines, leftNorm, rightNorm, leftMap, rightMap)
-	leftLabel := left
-	rightLabel := right
-	if opts.labelLeft != "" {
-		leftLabel = opts.labelLeft
-	}
-	if opts.labelRight != "" {
-		rightLabel = opts.labelRight
-	}
+	leftLabel := headerLabel(left, opts.labelLeft)
+	rightLabel := headerLabel(right, opts.labelRight)
 	writeUnified(stdio, lines, leftLabel, rightLabel, contextLines, opts, false, false)
 	return true, core.ExitSuccess, nil
 }
 
+// headerTimeLayout is the timestamp format used in unified diff file headers.
+const headerTimeLayout = "2006-01-02 15:04:05.000000000 -0700"
+
+// headerLabel returns the text for a ---/+++ header line: an explicit -L
+// label verbatim, otherwise the name followed by a tab and its mtime.
+// Absent files (-N) get the epoch, and stdin the current time.
+func headerLabel(name string, label string) string {
+	if label != "" {
+		return label
+	}
+	mtime := time.Now()
+	if name != "-" {
+		info, err := corefs.Stat(name)
+		if err != nil {
+			mtime = time.Unix(0, 0)
+		} else {
+			mtime = info.ModTime()
+		}
+	}
+	return name + "\t" + mtime.Format(headerTimeLayout)
+}
+
 func isBinary(data []byte) bool {
 	return bytes.IndexByte(data, 0) >= 0
 }
@@ -497,24 +590,28 @@ func normalizeLinesWithMap(lines []string, opts diffOptions) ([]string, []int) {
 	out := make([]string, 0, len(lines))
 	indexMap := make([]int, 0, len(lines))
 	for i, line := range lines {
-		normalized := line
-		if opts.ignoreBlank && strings.TrimSpace(normalized) == "" {
+		if opts.ignoreBlank && strings.TrimSpace(line) == "" {
 			continue
 		}
-		if opts.ignoreAllSpace {
-			normalized = strings.Join(strings.Fields(normalized), "")
-		} else if opts.ignoreSpaceAmount {
-			normalized = strings.Join(strings.Fields(normalized), " ")
-		}
-		if opts.ignoreCase {
-			normalized = strings.ToLower(normalized)
-		}
-		out = append(out, normalized)
+		out = append(out, normalizeLine(line, opts))
 		indexMap = append(indexMap, i)
 	}
 	return out, indexMap
 }
 
+// normalizeLine applies the -b, -w and -i transformations to one line.
+func normalizeLine(line string, opts diffOptions) string {
+	if opts.ignoreAllSpace {
+		line = strings.Join(strings.Fields(line), "")
+	} else if opts.ignoreSpaceAmount {
+		line = strings.Join(strings.Fields(line), " ")
+	}
+	if opts.ignoreCase {
+		line = strings.ToLower(line)
+	}
+	return line
+}
+
 func compareNormalized(leftData []byte, rightData []byte, opts diffOptions) bool {
 	if !opts.ignoreSpaceAmount && !opts.ignoreAllSpace && !opts.ignoreBlank && !opts.ignoreCase {
 		return false
@@ -1,9 +1,12 @@
 package diff_test
 
 import (
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/diff"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -323,3 +326,152 @@ func TestDiff(t *testing.T) {
 
 	testutil.RunAppletTests(t, diff.Run, tests)
 }
+
+func TestDiffUnifiedExact(t *testing.T) {
+	var left, right strings.Builder
+	for i := 1; i <= 10; i++ {
+		left.WriteString("l" + strconv.Itoa(i) + "\n")
+		switch i {
+		case 3, 7:
+			right.WriteString("X" + strconv.Itoa(i) + "\n")
+		default:
+			right.WriteString("l" + strconv.Itoa(i) + "\n")
+		}
+	}
+	files := map[string]string{"a.txt": left.String(), "b.txt": right.String()}
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "merged_hunk",
+			Args:     []string{"-u", "-L", "a", "-L", "b", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "--- a\n+++ b\n@@ -1,10 +1,10 @@\n l1\n l2\n-l3\n+X3\n l4\n l5\n l6\n-l7\n+X7\n l8\n l9\n l10\n",
+			Files:    files,
+		},
+		{
+			Name:     "split_hunks",
+			Args:     []string{"-U", "1", "-L", "a", "-L", "b", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "--- a\n+++ b\n@@ -2,3 +2,3 @@\n l2\n-l3\n+X3\n l4\n@@ -6,3 +6,3 @@\n l6\n-l7\n+X7\n l8\n",
+			Files:    files,
+		},
+	}
+	testutil.RunAppletTests(t, diff.Run, tests)
+}
+
+func TestDiffUnifiedHeaderTimes(t *testing.T) {
+	dir := testutil.TempDirWithFiles(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	left := filepath.Join(dir, "a.txt")
+	right := filepath.Join(dir, "b.txt")
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	for _, path := range []string{left, right} {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, _, code := testutil.CaptureAndRun(t, diff.Run, []string{"-u", left, right}, "")
+	testutil.AssertExitCode(t, code, 1)
+	stamp := mtime.Local().Format("2006-01-02 15:04:05.000000000 -0700")
+	want := "--- " + left + "\t" + stamp + "\n+++ " + right + "\t" + stamp + "\n@@ -1 +1 @@\n-a\n+b\n"
+	testutil.AssertOutput(t, out.String(), want)
+}
+
+func TestDiffRecursiveTrees(t *testing.T) {
+	setup := func(t *testing.T, dir string) {
+		_ = testutil.TempFileIn(t, dir, "left/same.txt", "same\n")
+		_ = testutil.TempFileIn(t, dir, "right/same.txt", "same\n")
+		_ = testutil.TempFileIn(t, dir, "left/deleted.txt", "gone\n")
+		_ = testutil.TempFileIn(t, dir, "right/added.txt", "new\n")
+		_ = testutil.TempFileIn(t, dir, "left/sub/mod.txt", "a\nb\n")
+		_ = testutil.TempFileIn(t, dir, "right/sub/mod.txt", "a\nc\n")
+		_ = testutil.TempFileIn(t, dir, "left/bin.dat", "a\x00b")
+		_ = testutil.TempFileIn(t, dir, "right/bin.dat", "a\x00c")
+		_ = testutil.TempFileIn(t, dir, "left/kind/file.txt", "x\n")
+		_ = testutil.TempFileIn(t, dir, "right/kind", "x\n")
+	}
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "brief",
+			Args:     []string{"-rq", "left", "right"},
+			WantCode: 1,
+			WantOut: "Only in right: added.txt\n" +
+				"Files left/bin.dat and right/bin.dat differ\n" +
+				"Only in left: deleted.txt\n" +
+				"File left/kind is a directory while file right/kind is a regular file\n" +
+				"Files left/sub/mod.txt and right/sub/mod.txt differ\n",
+			Setup: setup,
+		},
+		{
+			Name:     "unified",
+			Args:     []string{"-ru", "-L", "a", "-L", "b", "left", "right"},
+			WantCode: 1,
+			WantOut: "Only in right: added.txt\n" +
+				"Binary files left/bin.dat and right/bin.dat differ\n" +
+				"Only in left: deleted.txt\n" +
+				"File left/kind is a directory while file right/kind is a regular file\n" +
+				"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			Setup: setup,
+		},
+	}
+	testutil.RunAppletTests(t, diff.Run, tests)
+}
+
+func TestDiffIgnoreFlagsKeepOriginalLines(t *testing.T) {
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "ignore_case",
+			Args:     []string{"-i", "-L", "a", "-L", "b", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "--- a\n+++ b\n@@ -1,2 +1,2 @@\n Hello\n-foo\n+bar\n",
+			Files:    map[string]string{"a.txt": "Hello\nfoo\n", "b.txt": "hello\nbar\n"},
+		},
+		{
+			Name:     "ignore_all_space",
+			Args:     []string{"-w", "-L", "a", "-L", "b", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a b\n-x\n+y\n",
+			Files:    map[string]string{"a.txt": "a b\nx\n", "b.txt": "ab\ny\n"},
+		},
+		{
+			Name:     "ignore_space_amount",
+			Args:     []string{"-b", "-L", "a", "-L", "b", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a  b\n-x\n+y\n",
+			Files:    map[string]string{"a.txt": "a  b\nx\n", "b.txt": "a b\ny\n"},
+		},
+		{
+			Name:     "space_amount_is_not_all_space",
+			Args:     []string{"-q", "-b", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "Files a.txt and b.txt differ\n",
+			Files:    map[string]string{"a.txt": "a b\n", "b.txt": "ab\n"},
+		},
+		{
+			Name:     "brief_ignore_case_equal",
+			Args:     []string{"-q", "-i", "a.txt", "b.txt"},
+			WantCode: core.ExitSuccess,
+			WantOut:  "",
+			Files:    map[string]string{"a.txt": "ABC\n", "b.txt": "abc\n"},
+		},
+		{
+			Name:     "brief_all_space_equal",
+			Args:     []string{"-qw", "a.txt", "b.txt"},
+			WantCode: core.ExitSuccess,
+			Files:    map[string]string{"a.txt": "a b\tc\n", "b.txt": "abc\n"},
+		},
+		{
+			Name:     "brief_extra_line",
+			Args:     []string{"-q", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "Files a.txt and b.txt differ\n",
+			Files:    map[string]string{"a.txt": "a\n", "b.txt": "a\nb\n"},
+		},
+		{
+			Name:     "brief_missing_newline",
+			Args:     []string{"-q", "a.txt", "b.txt"},
+			WantCode: 1,
+			WantOut:  "Files a.txt and b.txt differ\n",
+			Files:    map[string]string{"a.txt": "a", "b.txt": "a\n"},
+		},
+	}
+	testutil.RunAppletTests(t, diff.Run, tests)
+}
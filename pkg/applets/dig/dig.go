@@ -21,9 +21,11 @@ type options struct {
 	qtype       uint16
 	qtypeLabel  string
 	server      string
+	serverName  string
 	port        string
 	useTCP      bool
 	shortOutput bool
+	trace       bool
 	reverse     bool
 	ipv4Only    bool
 	ipv6Only    bool
@@ -60,8 +62,18 @@ type dnsMessage struct {
 	authority  []dnsRR
 	additional []dnsRR
 	raw        []byte
+	tcp        bool
 }
 
+const (
+	flagTC        = 0x0200
+	flagRD        = 0x0100
+	rcodeMask     = 0x000f
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+	rcodeRefused  = 5
+)
+
 const (
 	dnsClassIN = 1
 	typeA      = 1
@@ -73,6 +85,8 @@ const (
 	typeTXT    = 16
 	typeAAAA   = 28
 	typeSRV    = 33
+	typeANY    = 255
+	typeCAA    = 257
 )
 
 var typeNames = map[string]uint16{
@@ -85,6 +99,8 @@ var typeNames = map[string]uint16{
 	"TXT":   typeTXT,
 	"AAAA":  typeAAAA,
 	"SRV":   typeSRV,
+	"ANY":   typeANY,
+	"CAA":   typeCAA,
 }
 
 // Run executes the dig command with the given arguments.
@@ -94,12 +110,23 @@ var typeNames = map[string]uint16{
 //	-x ADDR     Perform a reverse DNS lookup
 //	-4          Use IPv4 only
 //	-6          Use IPv6 only
-//	-t TYPE     Query type (A, AAAA, MX, NS, CNAME, TXT, SOA, PTR, SRV, ANY)
+//	-t TYPE     Query type (A, AAAA, MX, NS, CNAME, TXT, SOA, PTR, SRV, CAA, ANY)
 //	-p PORT     Use non-standard port number
-//	@SERVER     Specify the DNS server to query
+//	@SERVER     Specify the DNS server to query, optionally as SERVER#PORT;
+//	            a hostname is resolved with the system resolver first
+//	+short      Print only the answer data
+//	+tcp        Query over TCP instead of UDP
+//	+trace      Resolve iteratively from the root servers, printing each
+//	            referral step
+//
+// The first non-flag argument is the domain name to query; a following
+// type name (dig example.com MX) selects the query type. When no server
+// is specified, the system resolver from /etc/resolv.conf is used.
 //
-// The first non-flag argument is the domain name to query. When no
-// server is specified, the system resolver from /etc/resolv.conf is used.
+// Records are printed in dig's presentation format with their TTLs, in
+// labelled ANSWER, AUTHORITY and ADDITIONAL sections. Types without a
+// dedicated renderer use the RFC 3597 \# form. A truncated UDP reply is
+// retried over TCP.
 func Run(stdio *core.Stdio, args []string) int {
 	opts, code := parseArgs(stdio, args)
 	if code != core.ExitSuccess {
@@ -117,11 +144,17 @@ func Run(stdio *core.Stdio, args []string) int {
 		}
 	}
 
+	if opts.trace {
+		return runTrace(stdio, opts)
+	}
+
+	start := time.Now()
 	msg, err := lookup(opts)
 	if err != nil {
 		stdio.Errorf("dig: %v\n", err)
 		return core.ExitFailure
 	}
+	elapsed := time.Since(start)
 
 	if opts.shortOutput {
 		printShort(stdio, msg, opts)
@@ -129,6 +162,7 @@ func Run(stdio *core.Stdio, args []string) int {
 	}
 
 	printMessage(stdio, msg, opts)
+	printStats(stdio, msg, opts, elapsed)
 	return core.ExitSuccess
 }
 
@@ -143,7 +177,14 @@ func parseArgs(stdio *core.Stdio, args []string) (options, int) {
 			break
 		}
 		if strings.HasPrefix(arg, "@") {
-			opts.server = arg[1:]
+			server, port, found := strings.Cut(arg[1:], "#")
+			if server == "" || (found && port == "") {
+				return opts, core.UsageError(stdio, "dig", "invalid server")
+			}
+			opts.server = server
+			if found {
+				opts.port = port
+			}
 			args = args[1:]
 			continue
 		}
@@ -153,6 +194,8 @@ func parseArgs(stdio *core.Stdio, args []string) (options, int) {
 				opts.shortOutput = true
 			case "tcp":
 				opts.useTCP = true
+			case "trace":
+				opts.trace = true
 			default:
 				return opts, core.UsageError(stdio, "dig", "invalid option")
 			}
@@ -217,6 +260,10 @@ func parseArgs(stdio *core.Stdio, args []string) (options, int) {
 		return opts, core.UsageError(stdio, "dig", "cannot combine -4 and -6")
 	}
 
+	if _, err := strconv.ParseUint(opts.port, 10, 16); err != nil {
+		return opts, core.UsageError(stdio, "dig", "invalid port")
+	}
+
 	if opts.server == "" {
 		srv, err := defaultServer()
 		if err != nil {
@@ -224,9 +271,39 @@ func parseArgs(stdio *core.Stdio, args []string) (options, int) {
 		}
 		opts.server = srv
 	}
+	opts.serverName = opts.server
+	if net.ParseIP(opts.server) == nil {
+		addr, err := resolveServer(opts.server, opts)
+		if err != nil {
+			stdio.Errorf("dig: couldn't get address for '%s': %v\n", opts.server, err)
+			return opts, core.ExitFailure
+		}
+		opts.server = addr
+	}
 	return opts, core.ExitSuccess
 }
 
+// resolveServer looks up a server hostname with the system resolver,
+// honouring -4/-6.
+func resolveServer(host string, opts options) (string, error) {
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		isV4 := ip.To4() != nil
+		if (opts.ipv4Only && !isV4) || (opts.ipv6Only && isV4) {
+			continue
+		}
+		return addr, nil
+	}
+	return "", errors.New("no usable address")
+}
+
 func parseType(val string) (uint16, string, bool) {
 	upper := strings.ToUpper(val)
 	if t, ok := typeNames[upper]; ok {
@@ -251,7 +328,13 @@ func defaultServer() (string, error) {
 }
 
 func lookup(opts options) (*dnsMessage, error) {
-	msg, err := buildQuery(opts)
+	return query(opts.server, opts.qname, opts.qtype, true, opts)
+}
+
+// query sends a single question to server and returns the reply. recurse
+// sets the RD bit.
+func query(server string, name string, qtype uint16, recurse bool, opts options) (*dnsMessage, error) {
+	msg, err := buildQuery(name, qtype, recurse)
 	if err != nil {
 		return nil, err
 	}
@@ -260,14 +343,14 @@ func lookup(opts options) (*dnsMessage, error) {
 		return nil, err
 	}
 
-	server := net.JoinHostPort(opts.server, opts.port)
+	addr := net.JoinHostPort(server, opts.port)
 	if opts.ipv4Only {
-		return exchange("udp4", server, req, opts)
+		return exchange("udp4", addr, req, opts)
 	}
 	if opts.ipv6Only {
-		return exchange("udp6", server, req, opts)
+		return exchange("udp6", addr, req, opts)
 	}
-	return exchange("udp", server, req, opts)
+	return exchange("udp", addr, req, opts)
 }
 
 func exchange(network, addr string, req []byte, opts options) (*dnsMessage, error) {
@@ -294,7 +377,14 @@ func exchange(network, addr string, req []byte, opts options) (*dnsMessage, erro
 	if err != nil {
 		return nil, err
 	}
-	return unpackMessage(buf[:n])
+	msg, err := unpackMessage(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	if msg.header.flags&flagTC != 0 {
+		return exchangeTCP(network, addr, req)
+	}
+	return msg, nil
 }
 
 func exchangeTCP(network, addr string, req []byte) (*dnsMessage, error) {
@@ -326,7 +416,12 @@ func exchangeTCP(network, addr string, req []byte) (*dnsMessage, error) {
 	if _, err := io.ReadFull(conn, resp); err != nil {
 		return nil, err
 	}
-	return unpackMessage(resp)
+	msg, err := unpackMessage(resp)
+	if err != nil {
+		return nil, err
+	}
+	msg.tcp = true
+	return msg, nil
 }
 
 func networkSuffix(network string) string {
@@ -339,15 +434,18 @@ func networkSuffix(network string) string {
 	return ""
 }
 
-func buildQuery(opts options) (*dnsMessage, error) {
+func buildQuery(name string, qtype uint16, recurse bool) (*dnsMessage, error) {
 	id, err := randomUint16()
 	if err != nil {
 		return nil, err
 	}
-	flags := uint16(0x0100)
+	flags := uint16(0)
+	if recurse {
+		flags |= flagRD
+	}
 	return &dnsMessage{
 		header:    dnsHeader{id: id, flags: flags, qdcount: 1},
-		questions: []dnsQuestion{{name: opts.qname, qtype: opts.qtype, qclass: dnsClassIN}},
+		questions: []dnsQuestion{{name: name, qtype: qtype, qclass: dnsClassIN}},
 	}, nil
 }
 
@@ -530,7 +628,7 @@ func printShort(stdio *core.Stdio, msg *dnsMessage, opts options) {
 func printMessage(stdio *core.Stdio, msg *dnsMessage, opts options) {
 	stdio.Println(";; QUESTION SECTION:")
 	for _, q := range msg.questions {
-		stdio.Printf(";%s\t\tIN\t%s\n", q.name, opts.qtypeLabel)
+		stdio.Printf(";%s\t\tIN\t%s\n", fqdn(q.name), opts.qtypeLabel)
 	}
 	stdio.Println()
 
@@ -559,12 +657,25 @@ func printMessage(stdio *core.Stdio, msg *dnsMessage, opts options) {
 	}
 }
 
+// printStats prints the trailer dig shows after the message sections.
+func printStats(stdio *core.Stdio, msg *dnsMessage, opts options, elapsed time.Duration) {
+	transport := "UDP"
+	if msg.tcp {
+		transport = "TCP"
+	}
+	stdio.Printf(";; Query time: %d msec\n", elapsed.Milliseconds())
+	stdio.Printf(";; SERVER: %s#%s(%s) (%s)\n", opts.server, opts.port, opts.serverName, transport)
+	stdio.Printf(";; WHEN: %s\n", time.Now().Format("Mon Jan 02 15:04:05 MST 2006"))
+	stdio.Printf(";; MSG SIZE  rcvd: %d\n", len(msg.raw))
+	stdio.Println()
+}
+
 func formatRR(rr dnsRR, msg *dnsMessage, opts options) string {
 	data := formatRRData(rr, msg, opts, false)
 	if data == "" {
-		data = fmt.Sprintf("\\# %d", len(rr.rdata))
+		data = fmt.Sprintf("\\# %d %x", len(rr.rdata), rr.rdata)
 	}
-	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s", rr.name, rr.ttl, typeLabel(rr.rtype), data)
+	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s", fqdn(rr.name), rr.ttl, typeLabel(rr.rtype), data)
 }
 
 func formatRRData(rr dnsRR, msg *dnsMessage, opts options, short bool) string {
@@ -584,7 +695,7 @@ func formatRRData(rr dnsRR, msg *dnsMessage, opts options, short bool) string {
 		if err != nil {
 			return ""
 		}
-		return name
+		return fqdn(name)
 	case typeMX:
 		if len(rr.rdata) < 3 {
 			return ""
@@ -595,9 +706,9 @@ func formatRRData(rr dnsRR, msg *dnsMessage, opts options, short bool) string {
 			return ""
 		}
 		if short {
-			return name
+			return fqdn(name)
 		}
-		return fmt.Sprintf("%d %s", pref, name)
+		return fmt.Sprintf("%d %s", pref, fqdn(name))
 	case typeSOA:
 		mname, off, err := unpackName(msg.raw, rr.rdataOffset)
 		if err != nil {
@@ -616,16 +727,21 @@ func formatRRData(rr dnsRR, msg *dnsMessage, opts options, short bool) string {
 		retry := binary.BigEndian.Uint32(msg.raw[off+8 : off+12])
 		expire := binary.BigEndian.Uint32(msg.raw[off+12 : off+16])
 		minimum := binary.BigEndian.Uint32(msg.raw[off+16 : off+20])
-		return fmt.Sprintf("%s %s %d %d %d %d %d", mname, rname, serial, refresh, retry, expire, minimum)
+		return fmt.Sprintf("%s %s %d %d %d %d %d", fqdn(mname), fqdn(rname), serial, refresh, retry, expire, minimum)
 	case typeTXT:
-		if len(rr.rdata) < 1 {
-			return ""
+		var parts []string
+		for rest := rr.rdata; len(rest) > 0; {
+			length := int(rest[0])
+			if len(rest) < 1+length {
+				return ""
+			}
+			parts = append(parts, quoteString(rest[1:1+length]))
+			rest = rest[1+length:]
 		}
-		length := int(rr.rdata[0])
-		if len(rr.rdata) < 1+length {
+		if len(parts) == 0 {
 			return ""
 		}
-		return fmt.Sprintf("\"%s\"", string(rr.rdata[1:1+length]))
+		return strings.Join(parts, " ")
 	case typeSRV:
 		if len(rr.rdata) < 7 {
 			return ""
@@ -638,9 +754,20 @@ func formatRRData(rr dnsRR, msg *dnsMessage, opts options, short bool) string {
 			return ""
 		}
 		if short {
-			return target
+			return fqdn(target)
+		}
+		return fmt.Sprintf("%d %d %d %s", priority, weight, port, fqdn(target))
+	case typeCAA:
+		if len(rr.rdata) < 2 {
+			return ""
+		}
+		flags := rr.rdata[0]
+		tagLen := int(rr.rdata[1])
+		if len(rr.rdata) < 2+tagLen {
+			return ""
 		}
-		return fmt.Sprintf("%d %d %d %s", priority, weight, port, target)
+		tag := string(rr.rdata[2 : 2+tagLen])
+		return fmt.Sprintf("%d %s %s", flags, tag, quoteString(rr.rdata[2+tagLen:]))
 	default:
 		return ""
 	}
@@ -652,7 +779,36 @@ func typeLabel(t uint16) string {
 			return name
 		}
 	}
-	return strconv.Itoa(int(t))
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// fqdn returns name in absolute form with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// quoteString renders a DNS character-string in presentation format:
+// double-quoted, with quotes and backslashes escaped and non-printable
+// bytes written as \DDD.
+func quoteString(data []byte) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range data {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
 }
 
 func reverseName(ip net.IP) string {
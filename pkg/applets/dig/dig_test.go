@@ -1,6 +1,11 @@
 package dig_test
 
 import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/dig"
@@ -38,3 +43,443 @@ func TestDig(t *testing.T) {
 
 	testutil.RunAppletTests(t, dig.Run, tests)
 }
+
+func TestDigRecordTypes(t *testing.T) {
+	port := startStubServer(t, func(qname string, qtype uint16, tcp bool) stubReply {
+		switch qtype {
+		case 1: // A
+			return stubReply{answers: []stubRR{
+				{name: qname, rtype: 1, ttl: 300, rdata: []byte{192, 0, 2, 1}},
+				{name: qname, rtype: 1, ttl: 300, rdata: []byte{192, 0, 2, 2}},
+			}}
+		case 28: // AAAA
+			return stubReply{answers: []stubRR{{name: qname, rtype: 28, ttl: 60, rdata: net.ParseIP("2001:db8::1")}}}
+		case 5: // CNAME
+			return stubReply{answers: []stubRR{{name: qname, rtype: 5, ttl: 60, rdata: stubName("target.example.com")}}}
+		case 15: // MX
+			return stubReply{answers: []stubRR{{name: qname, rtype: 15, ttl: 3600, rdata: concat(u16(10), stubName("mail.example.com"))}}}
+		case 2: // NS
+			return stubReply{answers: []stubRR{{name: qname, rtype: 2, ttl: 86400, rdata: stubName("ns1.example.com")}}}
+		case 16: // TXT
+			return stubReply{answers: []stubRR{{name: qname, rtype: 16, ttl: 120, rdata: concat([]byte{5}, []byte("hello"), []byte{8}, []byte(`say "hi"`))}}}
+		case 6: // SOA
+			return stubReply{
+				answers: []stubRR{{name: qname, rtype: 6, ttl: 900, rdata: concat(stubName("ns1.example.com"), stubName("hostmaster.example.com"), u32(2024010101), u32(7200), u32(3600), u32(1209600), u32(300))}},
+			}
+		case 33: // SRV
+			return stubReply{answers: []stubRR{{name: qname, rtype: 33, ttl: 600, rdata: concat(u16(10), u16(5), u16(5060), stubName("sip.example.com"))}}}
+		case 12: // PTR
+			return stubReply{answers: []stubRR{{name: qname, rtype: 12, ttl: 600, rdata: stubName("host.example.com")}}}
+		case 257: // CAA
+			return stubReply{answers: []stubRR{{name: qname, rtype: 257, ttl: 600, rdata: concat([]byte{0, 5}, []byte("issue"), []byte("letsencrypt.org"))}}}
+		}
+		return stubReply{}
+	})
+	ns := stubRR{name: "example.com", rtype: 2, ttl: 100, rdata: stubName("ns1.example.com")}
+	glue := stubRR{name: "ns1.example.com", rtype: 1, ttl: 100, rdata: []byte{192, 0, 2, 53}}
+	sectionPort := startStubServer(t, func(qname string, qtype uint16, tcp bool) stubReply {
+		return stubReply{
+			answers:    []stubRR{{name: qname, rtype: 1, ttl: 5, rdata: []byte{192, 0, 2, 9}}},
+			authority:  []stubRR{ns},
+			additional: []stubRR{glue},
+		}
+	})
+	tests := []testutil.AppletTestCase{
+		{
+			Name:       "a_multiple",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "A"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ";; ANSWER SECTION:\nexample.com.\t300\tIN\tA\t192.0.2.1\nexample.com.\t300\tIN\tA\t192.0.2.2\n",
+		},
+		{
+			Name:       "aaaa",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "AAAA"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t60\tIN\tAAAA\t2001:db8::1\n",
+		},
+		{
+			Name:       "cname",
+			Args:       []string{"@127.0.0.1", "-p", port, "www.example.com", "CNAME"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "www.example.com.\t60\tIN\tCNAME\ttarget.example.com.\n",
+		},
+		{
+			Name:       "mx",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "MX"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t3600\tIN\tMX\t10 mail.example.com.\n",
+		},
+		{
+			Name:       "ns",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "ns"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t86400\tIN\tNS\tns1.example.com.\n",
+		},
+		{
+			Name:       "txt",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "TXT"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t120\tIN\tTXT\t\"hello\" \"say \\\"hi\\\"\"\n",
+		},
+		{
+			Name:       "soa",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "SOA"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t900\tIN\tSOA\tns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300\n",
+		},
+		{
+			Name:       "srv",
+			Args:       []string{"@127.0.0.1", "-p", port, "_sip._udp.example.com", "SRV"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "_sip._udp.example.com.\t600\tIN\tSRV\t10 5 5060 sip.example.com.\n",
+		},
+		{
+			Name:       "ptr",
+			Args:       []string{"@127.0.0.1", "-p", port, "1.2.0.192.in-addr.arpa", "PTR"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "1.2.0.192.in-addr.arpa.\t600\tIN\tPTR\thost.example.com.\n",
+		},
+		{
+			Name:       "caa",
+			Args:       []string{"@127.0.0.1", "-p", port, "example.com", "CAA"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t600\tIN\tCAA\t0 issue \"letsencrypt.org\"\n",
+		},
+		{
+			Name:       "sections",
+			Args:       []string{"@127.0.0.1", "-p", sectionPort, "example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ";; AUTHORITY SECTION:\nexample.com.\t100\tIN\tNS\tns1.example.com.\n\n;; ADDITIONAL SECTION:\nns1.example.com.\t100\tIN\tA\t192.0.2.53\n",
+		},
+	}
+	testutil.RunAppletTests(t, dig.Run, tests)
+}
+
+func TestDigServerAndReverse(t *testing.T) {
+	port := startStubServer(t, func(qname string, qtype uint16, tcp bool) stubReply {
+		switch {
+		case qtype == 12 && qname == "1.2.0.192.in-addr.arpa":
+			return stubReply{answers: []stubRR{{name: qname, rtype: 12, ttl: 60, rdata: stubName("v4.example.com")}}}
+		case qtype == 12 && qname == "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa":
+			return stubReply{answers: []stubRR{{name: qname, rtype: 12, ttl: 60, rdata: stubName("v6.example.com")}}}
+		case qtype == 1 && tcp:
+			return stubReply{answers: []stubRR{{name: qname, rtype: 1, ttl: 60, rdata: []byte{198, 51, 100, 7}}}}
+		case qtype == 1:
+			return stubReply{answers: []stubRR{{name: qname, rtype: 1, ttl: 60, rdata: []byte{192, 0, 2, 7}}}}
+		}
+		return stubReply{flags: 0x8183}
+	})
+	tests := []testutil.AppletTestCase{
+		{
+			Name:       "server_hash_port",
+			Args:       []string{"@127.0.0.1#" + port, "example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t60\tIN\tA\t192.0.2.7\n\n;; Query time: ",
+		},
+		{
+			Name:       "server_line",
+			Args:       []string{"@127.0.0.1#" + port, "example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ";; SERVER: 127.0.0.1#" + port + "(127.0.0.1) (UDP)\n",
+		},
+		{
+			Name:       "server_hostname",
+			Args:       []string{"-4", "@localhost#" + port, "example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ";; SERVER: 127.0.0.1#" + port + "(localhost) (UDP)\n",
+		},
+		{
+			Name:     "short",
+			Args:     []string{"@127.0.0.1", "-p", port, "+short", "example.com"},
+			WantCode: core.ExitSuccess,
+			WantOut:  "192.0.2.7\n",
+		},
+		{
+			Name:     "tcp",
+			Args:     []string{"@127.0.0.1#" + port, "+tcp", "+short", "example.com"},
+			WantCode: core.ExitSuccess,
+			WantOut:  "198.51.100.7\n",
+		},
+		{
+			Name:     "reverse_v4",
+			Args:     []string{"@127.0.0.1#" + port, "+short", "-x", "192.0.2.1"},
+			WantCode: core.ExitSuccess,
+			WantOut:  "v4.example.com.\n",
+		},
+		{
+			Name:     "reverse_v6",
+			Args:     []string{"@127.0.0.1#" + port, "+short", "-x", "2001:db8::1"},
+			WantCode: core.ExitSuccess,
+			WantOut:  "v6.example.com.\n",
+		},
+		{
+			Name:     "invalid_server",
+			Args:     []string{"@127.0.0.1#", "example.com"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid server",
+		},
+	}
+	testutil.RunAppletTests(t, dig.Run, tests)
+}
+
+func TestDigTrace(t *testing.T) {
+	port := startStubServer(t, func(qname string, qtype uint16, tcp bool) stubReply {
+		switch {
+		case qname == "" && qtype == 2:
+			return stubReply{
+				answers:    []stubRR{{name: ".", rtype: 2, ttl: 518400, rdata: stubName("a.root.test")}},
+				additional: []stubRR{{name: "a.root.test", rtype: 1, ttl: 518400, rdata: []byte{127, 0, 0, 2}}},
+			}
+		case qname == "big.example.com" && !tcp:
+			return stubReply{flags: 0x8380}
+		case qname == "big.example.com":
+			return stubReply{answers: []stubRR{{name: qname, rtype: 1, ttl: 60, rdata: []byte{192, 0, 2, 99}}}}
+		}
+		return stubReply{flags: 0x8185}
+	})
+	startStubServerAt(t, "127.0.0.2", port, func(qname string, qtype uint16, tcp bool) stubReply {
+		return stubReply{
+			flags:      0x8000,
+			authority:  []stubRR{{name: "com", rtype: 2, ttl: 172800, rdata: stubName("ns.com.test")}},
+			additional: []stubRR{{name: "ns.com.test", rtype: 1, ttl: 172800, rdata: []byte{127, 0, 0, 3}}},
+		}
+	})
+	startStubServerAt(t, "127.0.0.3", port, func(qname string, qtype uint16, tcp bool) stubReply {
+		if strings.HasSuffix(qname, "loop.com") {
+			return stubReply{
+				flags:      0x8000,
+				authority:  []stubRR{{name: "com", rtype: 2, ttl: 172800, rdata: stubName("ns.com.test")}},
+				additional: []stubRR{{name: "ns.com.test", rtype: 1, ttl: 172800, rdata: []byte{127, 0, 0, 3}}},
+			}
+		}
+		return stubReply{
+			flags:      0x8000,
+			authority:  []stubRR{{name: "example.com", rtype: 2, ttl: 172800, rdata: stubName("ns1.example.com")}},
+			additional: []stubRR{{name: "ns1.example.com", rtype: 1, ttl: 172800, rdata: []byte{127, 0, 0, 4}}},
+		}
+	})
+	startStubServerAt(t, "127.0.0.4", port, func(qname string, qtype uint16, tcp bool) stubReply {
+		return stubReply{
+			flags:   0x8400,
+			answers: []stubRR{{name: qname, rtype: 1, ttl: 300, rdata: []byte{192, 0, 2, 80}}},
+		}
+	})
+	tests := []testutil.AppletTestCase{
+		{
+			Name:       "root_step",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ".\t518400\tIN\tNS\ta.root.test.\n;; Received ",
+		},
+		{
+			Name:       "referrals",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "com.\t172800\tIN\tNS\tns.com.test.\n;; Received ",
+		},
+		{
+			Name:       "referral_server",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "example.com.\t172800\tIN\tNS\tns1.example.com.\n;; Received ",
+		},
+		{
+			Name:       "answer",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "www.example.com.\t300\tIN\tA\t192.0.2.80\n;; Received ",
+		},
+		{
+			Name:       "answer_server",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "from 127.0.0.4#" + port + "(ns1.example.com) in ",
+		},
+		{
+			Name:       "query_count",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ";; Total queries: 4\n",
+		},
+		{
+			Name:       "loop",
+			Args:       []string{"@127.0.0.1#" + port, "+trace", "www.loop.com"},
+			WantCode:   core.ExitFailure,
+			WantOutSub: ";; lame delegation from 127.0.0.3#" + port + "(ns.com.test): referral to com.\n",
+			WantErr:    "no usable servers for com.",
+		},
+		{
+			Name:       "truncated_retry_tcp",
+			Args:       []string{"@127.0.0.1#" + port, "big.example.com"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: ";; SERVER: 127.0.0.1#" + port + "(127.0.0.1) (TCP)\n",
+		},
+	}
+	testutil.RunAppletTests(t, dig.Run, tests)
+}
+
+// stubRR is a canned resource record served by the stub DNS server.
+type stubRR struct {
+	name  string
+	rtype uint16
+	ttl   uint32
+	rdata []byte
+}
+
+// stubReply is the canned response for a single query.
+type stubReply struct {
+	flags      uint16
+	answers    []stubRR
+	authority  []stubRR
+	additional []stubRR
+}
+
+// stubHandler builds the reply for a query name and type; tcp reports
+// whether the query arrived over TCP.
+type stubHandler func(qname string, qtype uint16, tcp bool) stubReply
+
+// startStubServer serves DNS over UDP on 127.0.0.1 and returns its port.
+func startStubServer(t *testing.T, handler stubHandler) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return serveStub(t, conn, "127.0.0.1", handler)
+}
+
+// startStubServerAt serves DNS on ip:port, skipping the test when the
+// address cannot be bound (other loopback addresses are Linux-only).
+func startStubServerAt(t *testing.T, ip, port string, handler stubHandler) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(ip, port))
+	if err != nil {
+		t.Skipf("listen %s: %v", ip, err)
+	}
+	serveStub(t, conn, ip, handler)
+}
+
+func serveStub(t *testing.T, conn net.PacketConn, ip string, handler stubHandler) string {
+	t.Helper()
+	t.Cleanup(func() { _ = conn.Close() })
+	port := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := stubRespond(buf[:n], handler, false)
+			if resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveStubTCP(c, handler)
+		}
+	}()
+	return port
+}
+
+func serveStubTCP(c net.Conn, handler stubHandler) {
+	defer c.Close()
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(c, hdr); err != nil {
+		return
+	}
+	req := make([]byte, binary.BigEndian.Uint16(hdr))
+	if _, err := io.ReadFull(c, req); err != nil {
+		return
+	}
+	resp := stubRespond(req, handler, true)
+	_, _ = c.Write(append(u16(uint16(len(resp))), resp...))
+}
+
+func stubRespond(req []byte, handler stubHandler, tcp bool) []byte {
+	if len(req) < 12 {
+		return nil
+	}
+	off := 12
+	var labels []string
+	for off < len(req) && req[off] != 0 {
+		l := int(req[off])
+		if off+1+l > len(req) {
+			return nil
+		}
+		labels = append(labels, string(req[off+1:off+1+l]))
+		off += 1 + l
+	}
+	off++
+	if off+4 > len(req) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(req[off : off+2])
+	question := req[12 : off+4]
+	reply := handler(strings.Join(labels, "."), qtype, tcp)
+	flags := reply.flags
+	if flags == 0 {
+		flags = 0x8180
+	}
+	resp := make([]byte, 12)
+	copy(resp[0:2], req[0:2])
+	binary.BigEndian.PutUint16(resp[2:4], flags)
+	binary.BigEndian.PutUint16(resp[4:6], 1)
+	binary.BigEndian.PutUint16(resp[6:8], uint16(len(reply.answers)))
+	binary.BigEndian.PutUint16(resp[8:10], uint16(len(reply.authority)))
+	binary.BigEndian.PutUint16(resp[10:12], uint16(len(reply.additional)))
+	resp = append(resp, question...)
+	for _, section := range [][]stubRR{reply.answers, reply.authority, reply.additional} {
+		for _, rr := range section {
+			resp = append(resp, stubName(rr.name)...)
+			tmp := make([]byte, 10)
+			binary.BigEndian.PutUint16(tmp[0:2], rr.rtype)
+			binary.BigEndian.PutUint16(tmp[2:4], 1)
+			binary.BigEndian.PutUint32(tmp[4:8], rr.ttl)
+			binary.BigEndian.PutUint16(tmp[8:10], uint16(len(rr.rdata)))
+			resp = append(resp, tmp...)
+			resp = append(resp, rr.rdata...)
+		}
+	}
+	return resp
+}
+
+// stubName encodes a domain name in uncompressed wire format.
+func stubName(name string) []byte {
+	var buf []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
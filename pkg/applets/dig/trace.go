@@ -0,0 +1,208 @@
+package dig
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcarmo/go-busybox/pkg/core"
+)
+
+// maxTraceSteps bounds the number of referrals +trace follows.
+const maxTraceSteps = 32
+
+// nameServer is a server address together with the name it is known by.
+type nameServer struct {
+	name string
+	addr string
+}
+
+// rootHints lists the IPv4 addresses of the root servers. They are used
+// when the configured resolver cannot supply the root NS set.
+var rootHints = []nameServer{
+	{"a.root-servers.net", "198.41.0.4"},
+	{"b.root-servers.net", "170.247.170.2"},
+	{"c.root-servers.net", "192.33.4.12"},
+	{"d.root-servers.net", "199.7.91.13"},
+	{"e.root-servers.net", "192.203.230.10"},
+	{"f.root-servers.net", "192.5.5.241"},
+	{"g.root-servers.net", "192.112.36.4"},
+	{"h.root-servers.net", "198.97.190.53"},
+	{"i.root-servers.net", "192.36.148.17"},
+	{"j.root-servers.net", "192.58.128.30"},
+	{"k.root-servers.net", "193.0.14.129"},
+	{"l.root-servers.net", "199.7.83.42"},
+	{"m.root-servers.net", "202.12.27.33"},
+}
+
+// runTrace resolves opts.qname iteratively. The configured server is only
+// asked for the root NS set; every later step sends a non-recursive query
+// to the servers named by the previous referral. Each reply is printed
+// followed by the server it came from, and the number of queries sent is
+// reported at the end.
+func runTrace(stdio *core.Stdio, opts options) int {
+	queries := 0
+	servers := rootHints
+
+	queries++
+	start := time.Now()
+	msg, err := query(opts.server, ".", typeNS, true, opts)
+	if err == nil && len(msg.answers) > 0 {
+		printTraceStep(stdio, msg, msg.answers, opts)
+		printReceived(stdio, msg, nameServer{opts.serverName, opts.server}, opts, time.Since(start))
+		if found := referralServers(msg, msg.answers, opts); len(found) > 0 {
+			servers = found
+		}
+	} else {
+		stdio.Println(";; using built-in root hints")
+		stdio.Println()
+	}
+
+	zone := ""
+	visited := map[string]bool{zone: true}
+	for step := 0; step < maxTraceSteps; step++ {
+		var resp *dnsMessage
+		var from nameServer
+		var referral []dnsRR
+		for _, ns := range servers {
+			queries++
+			start := time.Now()
+			r, err := query(ns.addr, opts.qname, opts.qtype, false, opts)
+			if err != nil {
+				stdio.Printf(";; query to %s#%s(%s) failed: %v\n", ns.addr, opts.port, ns.name, err)
+				continue
+			}
+			elapsed := time.Since(start)
+			rcode := r.header.flags & rcodeMask
+			if rcode == rcodeServFail || rcode == rcodeRefused {
+				stdio.Printf(";; lame server %s#%s(%s): %s\n", ns.addr, opts.port, ns.name, rcodeName(rcode))
+				continue
+			}
+			nsRRs := delegation(r)
+			if len(r.answers) == 0 && rcode == 0 && len(nsRRs) > 0 {
+				child := canonicalName(nsRRs[0].name)
+				if visited[child] || !inZone(child, zone) || !inZone(canonicalName(opts.qname), child) {
+					stdio.Printf(";; lame delegation from %s#%s(%s): referral to %s\n", ns.addr, opts.port, ns.name, fqdn(child))
+					continue
+				}
+			}
+			printTraceStep(stdio, r, append(append([]dnsRR{}, r.answers...), r.authority...), opts)
+			printReceived(stdio, r, ns, opts, elapsed)
+			resp, from, referral = r, ns, nsRRs
+			break
+		}
+		if resp == nil {
+			stdio.Errorf("dig: no usable servers for %s\n", fqdn(zone))
+			printQueryCount(stdio, queries)
+			return core.ExitFailure
+		}
+		if len(resp.answers) > 0 || resp.header.flags&rcodeMask != 0 || len(referral) == 0 {
+			printQueryCount(stdio, queries)
+			return core.ExitSuccess
+		}
+
+		zone = canonicalName(referral[0].name)
+		visited[zone] = true
+		servers = referralServers(resp, referral, opts)
+		if len(servers) == 0 {
+			stdio.Errorf("dig: couldn't get address for any %s name server (referred by %s)\n", fqdn(zone), from.name)
+			printQueryCount(stdio, queries)
+			return core.ExitFailure
+		}
+	}
+	stdio.Errorf("dig: too many referrals\n")
+	printQueryCount(stdio, queries)
+	return core.ExitFailure
+}
+
+func printTraceStep(stdio *core.Stdio, msg *dnsMessage, rrs []dnsRR, opts options) {
+	for _, rr := range rrs {
+		stdio.Println(formatRR(rr, msg, opts))
+	}
+}
+
+func printReceived(stdio *core.Stdio, msg *dnsMessage, ns nameServer, opts options, elapsed time.Duration) {
+	transport := "UDP"
+	if msg.tcp {
+		transport = "TCP"
+	}
+	stdio.Printf(";; Received %d bytes from %s#%s(%s) in %d ms (%s)\n", len(msg.raw), ns.addr, opts.port, ns.name, elapsed.Milliseconds(), transport)
+	stdio.Println()
+}
+
+func printQueryCount(stdio *core.Stdio, queries int) {
+	stdio.Printf(";; Total queries: %d\n", queries)
+}
+
+// delegation returns the NS records of a referral's authority section.
+func delegation(msg *dnsMessage) []dnsRR {
+	var out []dnsRR
+	for _, rr := range msg.authority {
+		if rr.rtype == typeNS {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// referralServers maps the targets of nsRRs to addresses, preferring glue
+// from the additional section and falling back to the system resolver for
+// names without glue.
+func referralServers(msg *dnsMessage, nsRRs []dnsRR, opts options) []nameServer {
+	want := uint16(typeA)
+	if opts.ipv6Only {
+		want = typeAAAA
+	}
+	var names []string
+	var out []nameServer
+	for _, rr := range nsRRs {
+		if rr.rtype != typeNS {
+			continue
+		}
+		target, _, err := unpackName(msg.raw, rr.rdataOffset)
+		if err != nil {
+			continue
+		}
+		names = append(names, target)
+		for _, glue := range msg.additional {
+			if glue.rtype == want && canonicalName(glue.name) == canonicalName(target) {
+				out = append(out, nameServer{target, net.IP(glue.rdata).String()})
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, name := range names {
+		addr, err := resolveServer(name, opts)
+		if err == nil {
+			out = append(out, nameServer{name, addr})
+		}
+	}
+	return out
+}
+
+// canonicalName lower-cases name and strips the trailing dot; the root is
+// the empty string.
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// inZone reports whether name is zone or lies below it. Both must be in
+// canonical form.
+func inZone(name, zone string) bool {
+	return zone == "" || name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+func rcodeName(rcode uint16) string {
+	switch rcode {
+	case rcodeServFail:
+		return "SERVFAIL"
+	case rcodeNXDomain:
+		return "NXDOMAIN"
+	case rcodeRefused:
+		return "REFUSED"
+	}
+	return "RCODE" + strconv.Itoa(int(rcode))
+}
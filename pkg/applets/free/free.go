@@ -4,8 +4,10 @@ package free
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
 )
@@ -19,6 +21,15 @@ const (
 	unitGB        = 1024 * 1024 * 1024
 )
 
+type options struct {
+	scale unit
+	human bool
+	wide  bool
+	total bool
+	delay time.Duration // -s; zero means a single report
+	count int           // -c; zero means until interrupted
+}
+
 // Run executes the free command with the given arguments.
 //
 // Supported flags:
@@ -28,69 +39,147 @@ const (
 //	-m    Display amounts in mebibytes
 //	-g    Display amounts in gibibytes
 //	-h    Human-readable output with automatic unit selection
+//	-w    Wide output: separate buffers and cache columns
+//	-t    Add a line with RAM and swap totals
+//	-s N  Repeat every N seconds (fractions allowed) until interrupted
+//	-c N  Stop after N reports; implies -s 1 when -s is not given
 //
-// Reads memory statistics from /proc/meminfo.
+// Reads memory statistics from /proc/meminfo, afresh for every report.
+// Human-readable amounts use binary suffixes (B, Ki, Mi, Gi, ...) as
+// procps free does. Repeated reports are each followed by a blank line,
+// and SIGINT ends the loop with a successful exit.
 func Run(stdio *core.Stdio, args []string) int {
-	scale := unit(unitKB)
-	human := false
-	for _, arg := range args {
-		switch arg {
-		case "-b":
-			scale = unitByte
-		case "-k":
-			scale = unitKB
-		case "-m":
-			scale = unitMB
-		case "-g":
-			scale = unitGB
-		case "-h":
-			human = true
-		default:
-			if strings.HasPrefix(arg, "-") {
-				return core.UsageError(stdio, "free", "invalid option -- '"+strings.TrimPrefix(arg, "-")+"'")
+	opts := options{scale: unitKB}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			switch c {
+			case 'b':
+				opts.scale = unitByte
+			case 'k':
+				opts.scale = unitKB
+			case 'm':
+				opts.scale = unitMB
+			case 'g':
+				opts.scale = unitGB
+			case 'h':
+				opts.human = true
+			case 'w':
+				opts.wide = true
+			case 't':
+				opts.total = true
+			case 's', 'c':
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return core.UsageError(stdio, "free", "option requires an argument -- '"+string(c)+"'")
+					}
+					i++
+					value = args[i]
+				}
+				if c == 's' {
+					secs, err := strconv.ParseFloat(value, 64)
+					if err != nil || secs <= 0 {
+						return core.UsageError(stdio, "free", "seconds argument '"+value+"' failed")
+					}
+					opts.delay = time.Duration(secs * float64(time.Second))
+				} else {
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 1 {
+						return core.UsageError(stdio, "free", "count argument '"+value+"' failed")
+					}
+					opts.count = n
+				}
+				j = len(arg)
+			default:
+				return core.UsageError(stdio, "free", "invalid option -- '"+string(c)+"'")
 			}
 		}
 	}
+	if opts.delay == 0 && opts.count == 0 {
+		return show(stdio, opts)
+	}
+	if opts.delay == 0 {
+		opts.delay = time.Second
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	for n := 1; ; n++ {
+		if code := show(stdio, opts); code != core.ExitSuccess {
+			return code
+		}
+		stdio.Println()
+		if opts.count > 0 && n >= opts.count {
+			return core.ExitSuccess
+		}
+		select {
+		case <-time.After(opts.delay):
+		case <-interrupt:
+			return core.ExitSuccess
+		}
+	}
+}
+
+// show reads /proc/meminfo afresh and prints one report.
+func show(stdio *core.Stdio, opts options) int {
 	stats, err := readMeminfo()
 	if err != nil {
 		stdio.Errorf("free: %v\n", err)
 		return core.ExitFailure
 	}
-	stdio.Println("              total        used        free      shared  buff/cache   available")
+	format := func(v int64) string { return strconv.FormatInt(convertUnit(v, opts.scale), 10) }
+	if opts.human {
+		format = formatHuman
+	}
+
 	memUsed := stats.MemTotal - stats.MemFree - stats.Buffers - stats.Cached - stats.SReclaimable
-	buffCache := stats.Buffers + stats.Cached + stats.SReclaimable
-	if human {
-		stdio.Printf("Mem:%15s%12s%12s%12s%12s%12s\n",
-			padHuman(formatHuman(stats.MemTotal)),
-			padHuman(formatHuman(memUsed)),
-			padHuman(formatHuman(stats.MemFree)),
-			padHuman(formatHuman(stats.Shmem)),
-			padHuman(formatHuman(buffCache)),
-			padHuman(formatHuman(stats.MemAvailable)),
-		)
-		stdio.Printf("Swap:%14s%12s%12s\n",
-			padHuman(formatHuman(stats.SwapTotal)),
-			padHuman(formatHuman(stats.SwapTotal-stats.SwapFree)),
-			padHuman(formatHuman(stats.SwapFree)),
-		)
-		return core.ExitSuccess
-	}
-	stdio.Printf("Mem:%15d%12d%12d%12d%12d%12d\n",
-		convertUnit(stats.MemTotal, scale),
-		convertUnit(memUsed, scale),
-		convertUnit(stats.MemFree, scale),
-		convertUnit(stats.Shmem, scale),
-		convertUnit(buffCache, scale),
-		convertUnit(stats.MemAvailable, scale),
-	)
-	stdio.Printf("Swap:%14d%12d%12d\n",
-		convertUnit(stats.SwapTotal, scale),
-		convertUnit(stats.SwapTotal-stats.SwapFree, scale),
-		convertUnit(stats.SwapFree, scale),
-	)
+	cache := stats.Cached + stats.SReclaimable
+	header := []string{"total", "used", "free", "shared", "buff/cache", "available"}
+	mem := []int64{stats.MemTotal, memUsed, stats.MemFree, stats.Shmem, stats.Buffers + cache, stats.MemAvailable}
+	if opts.wide {
+		header = []string{"total", "used", "free", "shared", "buffers", "cache", "available"}
+		mem = []int64{stats.MemTotal, memUsed, stats.MemFree, stats.Shmem, stats.Buffers, cache, stats.MemAvailable}
+	}
+	swapUsed := stats.SwapTotal - stats.SwapFree
+
+	stdio.Println(strings.TrimRight(formatRow("", header), " "))
+	stdio.Println(formatRow("Mem:", formatAll(mem, format)))
+	stdio.Println(formatRow("Swap:", formatAll([]int64{stats.SwapTotal, swapUsed, stats.SwapFree}, format)))
+	if opts.total {
+		stdio.Println(formatRow("Total:", formatAll([]int64{
+			stats.MemTotal + stats.SwapTotal,
+			memUsed + swapUsed,
+			stats.MemFree + stats.SwapFree,
+		}, format)))
+	}
 	return core.ExitSuccess
 }
 
+// formatRow lays out a label followed by right-aligned 12-column fields,
+// so the first field ends at column 19 as in busybox free.
+func formatRow(label string, fields []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-7s", label)
+	for _, f := range fields {
+		fmt.Fprintf(&b, "%12s", f)
+	}
+	return b.String()
+}
+
+func formatAll(values []int64, format func(int64) string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = format(v)
+	}
+	return out
+}
+
 type memInfo struct {
 	MemTotal     int64
 	MemFree      int64
@@ -109,6 +198,7 @@ func readMeminfo() (memInfo, error) {
 		return memInfo{}, err
 	}
 	var info memInfo
+	haveAvailable := false
 	for _, line := range strings.Split(string(data), "\n") {
 		fields := strings.Fields(line)
 		if len(fields) < 2 {
@@ -123,6 +213,7 @@ func readMeminfo() (memInfo, error) {
 			info.MemFree = value * 1024
 		case "MemAvailable":
 			info.MemAvailable = value * 1024
+			haveAvailable = true
 		case "Buffers":
 			info.Buffers = value * 1024
 		case "Cached":
@@ -137,6 +228,11 @@ func readMeminfo() (memInfo, error) {
 			info.SwapFree = value * 1024
 		}
 	}
+	if !haveAvailable {
+		// Kernels before 3.14 do not export MemAvailable; approximate it
+		// with the memory that is free or easily reclaimed.
+		info.MemAvailable = info.MemFree + info.Buffers + info.Cached + info.SReclaimable
+	}
 	return info, nil
 }
 
@@ -147,22 +243,22 @@ func convertUnit(value int64, scale unit) int64 {
 	return value / int64(scale)
 }
 
+// formatHuman renders a byte count with a binary suffix: one decimal
+// below 10 (5.9Gi), whole numbers above (519Mi), plain bytes below 1Ki.
 func formatHuman(value int64) string {
-	switch {
-	case value >= int64(unitGB):
-		return fmt.Sprintf("%.1fG", float64(value)/float64(unitGB))
-	case value >= int64(unitMB):
-		return fmt.Sprintf("%.1fM", float64(value)/float64(unitMB))
-	case value >= int64(unitKB):
-		return fmt.Sprintf("%.1fK", float64(value)/float64(unitKB))
-	default:
-		return fmt.Sprintf("%dB", value)
+	if value < 1024 {
+		return strconv.FormatInt(value, 10) + "B"
 	}
-}
-
-func padHuman(value string) string {
-	if strings.HasSuffix(value, "B") {
-		return strings.TrimSuffix(value, "B")
+	v := float64(value)
+	suffix := 0
+	for v >= 1024 && suffix < len(humanSuffixes)-1 {
+		v /= 1024
+		suffix++
+	}
+	if v < 10 {
+		return fmt.Sprintf("%.1f%s", v, humanSuffixes[suffix])
 	}
-	return value
+	return fmt.Sprintf("%.0f%s", v, humanSuffixes[suffix])
 }
+
+var humanSuffixes = []string{"B", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei"}
@@ -1,7 +1,14 @@
 package free_test
 
 import (
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/free"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -22,6 +29,36 @@ func TestFree(t *testing.T) {
 			WantCode:   core.ExitSuccess,
 			WantOutSub: "Swap:",
 		},
+		{
+			Name:       "wide",
+			Args:       []string{"-w"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "shared     buffers       cache   available\n",
+		},
+		{
+			Name:       "total",
+			Args:       []string{"-t"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "\nTotal: ",
+		},
+		{
+			Name:     "bad_seconds",
+			Args:     []string{"-s", "0"},
+			WantCode: core.ExitUsage,
+			WantErr:  "seconds argument '0' failed",
+		},
+		{
+			Name:     "bad_count",
+			Args:     []string{"-c0"},
+			WantCode: core.ExitUsage,
+			WantErr:  "count argument '0' failed",
+		},
+		{
+			Name:     "missing_seconds",
+			Args:     []string{"-s"},
+			WantCode: core.ExitUsage,
+			WantErr:  "requires an argument",
+		},
 		{
 			Name:     "invalid_option",
 			Args:     []string{"-Z"},
@@ -31,3 +68,145 @@ func TestFree(t *testing.T) {
 	}
 	testutil.RunAppletTests(t, free.Run, tests)
 }
+
+// memTotalKB reads MemTotal, which does not change while the tests run.
+func memTotalKB(t *testing.T) int64 {
+	t.Helper()
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		t.Skipf("no /proc/meminfo: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "MemTotal:" {
+			n, _ := strconv.ParseInt(fields[1], 10, 64)
+			return n
+		}
+	}
+	t.Fatal("MemTotal missing from /proc/meminfo")
+	return 0
+}
+
+// rows runs free and returns the fields of each output line by label.
+func rows(t *testing.T, args ...string) map[string][]string {
+	t.Helper()
+	out, _, code := testutil.CaptureAndRun(t, free.Run, args, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	rows := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimRight(out.String(), "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+			rows[fields[0]] = fields[1:]
+		}
+	}
+	return rows
+}
+
+func TestFreeUnits(t *testing.T) {
+	total := memTotalKB(t)
+	for _, tc := range []struct {
+		flag string
+		want int64
+	}{
+		{"-b", total * 1024},
+		{"-k", total},
+		{"-m", total / 1024},
+		{"-g", total / (1024 * 1024)},
+	} {
+		mem := rows(t, tc.flag)["Mem:"]
+		if len(mem) != 6 || mem[0] != strconv.FormatInt(tc.want, 10) {
+			t.Errorf("free %s: Mem: %v, want total %d", tc.flag, mem, tc.want)
+		}
+	}
+
+	human := regexp.MustCompile(`^([0-9]+B|[0-9]\.[0-9](Ki|Mi|Gi|Ti)|[0-9]{2,4}(Ki|Mi|Gi|Ti))$`)
+	got := rows(t, "-hwt")
+	if len(got["Mem:"]) != 7 || len(got["Swap:"]) != 3 || len(got["Total:"]) != 3 {
+		t.Fatalf("free -hwt: unexpected layout %v", got)
+	}
+	for label, fields := range got {
+		for _, f := range fields {
+			if !human.MatchString(f) {
+				t.Errorf("free -h: %s field %q is not human-readable", label, f)
+			}
+		}
+	}
+
+	plain := rows(t, "-t")
+	mem, swap, sum := plain["Mem:"], plain["Swap:"], plain["Total:"]
+	memTotal, _ := strconv.ParseInt(mem[0], 10, 64)
+	swapTotal, _ := strconv.ParseInt(swap[0], 10, 64)
+	if sum[0] != strconv.FormatInt(memTotal+swapTotal, 10) {
+		t.Errorf("Total: %v does not add Mem: %v and Swap: %v", sum, mem, swap)
+	}
+}
+
+func TestFreeRepeat(t *testing.T) {
+	out, _, code := testutil.CaptureAndRun(t, free.Run, []string{"-m", "-s", "0.01", "-c", "3"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	reports := strings.Split(out.String(), "\n\n")
+	if len(reports) != 4 || reports[3] != "" {
+		t.Fatalf("want 3 reports each followed by a blank line, got:\n%s", out.String())
+	}
+	for _, r := range reports[:3] {
+		if !strings.HasPrefix(r, "              total") || !strings.Contains(r, "\nSwap:") {
+			t.Errorf("malformed report:\n%s", r)
+		}
+	}
+
+	// -c on its own still stops, after a one-second interval.
+	start := time.Now()
+	out, _, code = testutil.CaptureAndRun(t, free.Run, []string{"-c2"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	if n := strings.Count(out.String(), "Mem:"); n != 2 {
+		t.Errorf("free -c2 printed %d reports", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("free -c2 took %v, want the default one-second interval", elapsed)
+	}
+}
+
+// syncBuffer lets the test read output while free is still writing.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFreeInterrupt(t *testing.T) {
+	var out syncBuffer
+	done := make(chan int, 1)
+	go func() {
+		done <- free.Run(&core.Stdio{In: strings.NewReader(""), Out: &out, Err: &out}, []string{"-s", "60"})
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "Swap:") {
+		if time.Now().After(deadline) {
+			t.Fatal("no report printed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := self.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot signal self: %v", err)
+	}
+	select {
+	case code := <-done:
+		testutil.AssertExitCode(t, code, core.ExitSuccess)
+	case <-time.After(5 * time.Second):
+		t.Fatal("free -s did not stop on SIGINT")
+	}
+}
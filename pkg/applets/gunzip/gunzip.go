@@ -2,10 +2,13 @@
 package gunzip
 
 import (
+	"bufio"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -19,17 +22,21 @@ import (
 //	-c    Write to stdout, keep original files
 //	-f    Force overwrite of output file
 //	-k    Keep (don't delete) input files
+//	-r    Decompress the files below directory arguments
 //	-t    Test compressed file integrity (not implemented, accepted)
 //	-n    Do not save or restore the original filename
 //	-q    Suppress warnings
 //	-v    Verbose output
 //
 // Reads from stdin when no files are given or when "-" is specified.
-// Output filename is derived by removing the .gz suffix.
+// Output filename is derived by removing the .gz suffix. Concatenated
+// gzip members are decompressed one after another; anything after the
+// last member that is not a gzip header is ignored with a warning.
 func Run(stdio *core.Stdio, args []string) int {
 	toStdout := false
 	keep := false
 	force := false
+	recursive := false
 	var files []string
 
 	for i := 0; i < len(args); i++ {
@@ -45,6 +52,8 @@ func Run(stdio *core.Stdio, args []string) int {
 					toStdout = true
 				case 'f':
 					force = true
+				case 'r':
+					recursive = true
 				case 'k':
 					keep = true
 				case 'n':
@@ -79,76 +88,139 @@ func Run(stdio *core.Stdio, args []string) int {
 			continue
 		}
 
-		// Check file exists
 		info, err := corefs.Stat(path)
-		if err != nil {
-			stdio.Errorf("gunzip: %s: No such file or directory\n", path)
-			exitCode = core.ExitFailure
+		if err == nil && info.IsDir() && recursive {
+			if !gunzipTree(stdio, path, toStdout, keep, force) {
+				exitCode = core.ExitFailure
+			}
 			continue
 		}
-
-		// Check it's a regular file
-		if !info.Mode().IsRegular() {
-			stdio.Errorf("gunzip: %s: not a regular file\n", path)
+		if !gunzipPath(stdio, path, toStdout, keep, force) {
 			exitCode = core.ExitFailure
-			continue
 		}
+	}
+	return exitCode
+}
 
-		// Check for known suffix
-		outPath := ""
-		for _, suffix := range []string{".gz", ".tgz", ".Z"} {
-			if strings.HasSuffix(path, suffix) {
-				if suffix == ".tgz" {
-					outPath = strings.TrimSuffix(path, suffix) + ".tar"
-				} else {
-					outPath = strings.TrimSuffix(path, suffix)
-				}
-				break
-			}
-		}
-		if outPath == "" && !toStdout && !force {
+// gunzipTree restores every compressed file below dir. Files without a
+// known suffix are reported and skipped without failing the run, and
+// symbolic links are not followed.
+func gunzipTree(stdio *core.Stdio, dir string, toStdout, keep, force bool) bool {
+	entries, err := corefs.ReadDir(dir)
+	if err != nil {
+		stdio.Errorf("gunzip: %v\n", err)
+		return false
+	}
+	ok := true
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			ok = gunzipTree(stdio, path, toStdout, keep, force) && ok
+		case !entry.Type().IsRegular():
+		case outputName(path) == "":
 			stdio.Errorf("gunzip: %s: unknown suffix - ignored\n", path)
-			exitCode = core.ExitFailure
-			continue
-		}
-		if outPath == "" {
-			outPath = path + ".out"
+		default:
+			ok = gunzipPath(stdio, path, toStdout, keep, force) && ok
 		}
+	}
+	return ok
+}
 
-		if toStdout {
-			if err := gunzipFileToWriter(path, stdio.Out, stdio); err != nil {
-				exitCode = core.ExitFailure
-			}
-		} else {
-			// Check if output file already exists
-			if _, err := corefs.Stat(outPath); err == nil && !force {
-				stdio.Errorf("gunzip: can't open '%s': File exists\n", outPath)
-				exitCode = core.ExitFailure
-				continue
-			}
+// outputName returns the name path decompresses to, or "" when it has
+// none of the known suffixes.
+func outputName(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".tgz"):
+		return strings.TrimSuffix(path, ".tgz") + ".tar"
+	case strings.HasSuffix(path, ".gz"):
+		return strings.TrimSuffix(path, ".gz")
+	case strings.HasSuffix(path, ".Z"):
+		return strings.TrimSuffix(path, ".Z")
+	}
+	return ""
+}
 
-			if err := gunzipFileToFile(path, outPath, keep, stdio); err != nil {
-				exitCode = core.ExitFailure
-			}
-		}
+// gunzipPath decompresses a single file and reports whether it worked.
+func gunzipPath(stdio *core.Stdio, path string, toStdout, keep, force bool) bool {
+	info, err := corefs.Stat(path)
+	if err != nil {
+		stdio.Errorf("gunzip: %s: No such file or directory\n", path)
+		return false
 	}
-	return exitCode
+	if !info.Mode().IsRegular() {
+		stdio.Errorf("gunzip: %s: not a regular file\n", path)
+		return false
+	}
+
+	outPath := outputName(path)
+	if outPath == "" && !toStdout && !force {
+		stdio.Errorf("gunzip: %s: unknown suffix - ignored\n", path)
+		return false
+	}
+	if outPath == "" {
+		outPath = path + ".out"
+	}
+
+	if toStdout {
+		return gunzipFileToWriter(path, stdio.Out, stdio) == nil
+	}
+	if _, err := corefs.Stat(outPath); err == nil && !force {
+		stdio.Errorf("gunzip: can't open '%s': File exists\n", outPath)
+		return false
+	}
+	return gunzipFileToFile(path, outPath, keep, stdio) == nil
 }
 
 func gunzipStream(in io.Reader, out io.Writer, stdio *core.Stdio) int {
-	r, err := gzip.NewReader(in)
-	if err != nil {
-		stdio.Errorf("gunzip: %v\n", err)
+	garbage, err := decompress(in, out)
+	if errors.Is(err, gzip.ErrHeader) {
+		stdio.Errorf("gunzip: stdin: not in gzip format\n")
 		return core.ExitFailure
 	}
-	defer r.Close()
-	if _, err := io.Copy(out, r); err != nil {
+	if err != nil {
 		stdio.Errorf("gunzip: %v\n", err)
 		return core.ExitFailure
 	}
+	if garbage {
+		stdio.Errorf("gunzip: stdin: decompression OK, trailing garbage ignored\n")
+	}
 	return core.ExitSuccess
 }
 
+// decompress copies every gzip member in in to out, as gzip does for
+// concatenated files. Bytes after a complete member that do not start
+// another one are skipped and reported through garbage.
+func decompress(in io.Reader, out io.Writer) (garbage bool, err error) {
+	br := bufio.NewReader(in)
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return false, err
+	}
+	defer zr.Close()
+	for {
+		zr.Multistream(false)
+		if _, err := io.Copy(out, zr); err != nil {
+			return false, err
+		}
+		magic, err := br.Peek(2)
+		if len(magic) == 0 && err == io.EOF {
+			return false, nil
+		}
+		if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+			return true, nil
+		}
+		if err := zr.Reset(br); err != nil {
+			// Magic bytes followed by a bad or short header are
+			// garbage too.
+			if errors.Is(err, gzip.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				return true, nil
+			}
+			return false, err
+		}
+	}
+}
+
 func gunzipFileToWriter(path string, out io.Writer, stdio *core.Stdio) error {
 	in, err := corefs.Open(path)
 	if err != nil {
@@ -156,18 +228,23 @@ func gunzipFileToWriter(path string, out io.Writer, stdio *core.Stdio) error {
 		return err
 	}
 	defer in.Close()
+	return decompressFile(path, in, out, stdio)
+}
 
-	r, err := gzip.NewReader(in)
-	if err != nil {
+// decompressFile runs decompress and reports problems against path.
+func decompressFile(path string, in io.Reader, out io.Writer, stdio *core.Stdio) error {
+	garbage, err := decompress(in, out)
+	if errors.Is(err, gzip.ErrHeader) {
 		stdio.Errorf("gunzip: %s: not in gzip format\n", path)
 		return fmt.Errorf("not gzip")
 	}
-	defer r.Close()
-
-	if _, err := io.Copy(out, r); err != nil {
+	if err != nil {
 		stdio.Errorf("gunzip: %v\n", err)
 		return err
 	}
+	if garbage {
+		stdio.Errorf("gunzip: %s: decompression OK, trailing garbage ignored\n", path)
+	}
 	return nil
 }
 
@@ -179,12 +256,15 @@ func gunzipFileToFile(path, outPath string, keep bool, stdio *core.Stdio) error
 	}
 	defer in.Close()
 
-	r, err := gzip.NewReader(in)
-	if err != nil {
+	var magic [2]byte
+	if _, err := io.ReadFull(in, magic[:]); err != nil || magic != [2]byte{0x1f, 0x8b} {
 		stdio.Errorf("gunzip: %s: not in gzip format\n", path)
 		return fmt.Errorf("not gzip")
 	}
-	defer r.Close()
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		stdio.Errorf("gunzip: %v\n", err)
+		return err
+	}
 
 	out, err := corefs.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
@@ -193,8 +273,7 @@ func gunzipFileToFile(path, outPath string, keep bool, stdio *core.Stdio) error
 	}
 	defer out.Close()
 
-	if _, err := io.Copy(out, r); err != nil {
-		stdio.Errorf("gunzip: %v\n", err)
+	if err := decompressFile(path, in, out, stdio); err != nil {
 		return err
 	}
 
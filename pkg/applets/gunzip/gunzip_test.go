@@ -3,6 +3,10 @@ package gunzip_test
 import (
 	"bytes"
 	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/gunzip"
@@ -16,6 +20,12 @@ func TestGunzip(t *testing.T) {
 	_, _ = zw.Write([]byte("hello\n"))
 	_ = zw.Close()
 
+	var second bytes.Buffer
+	zw = gzip.NewWriter(&second)
+	_, _ = zw.Write([]byte("world\n"))
+	_ = zw.Close()
+	concatenated := buf.String() + second.String()
+
 	tests := []testutil.AppletTestCase{
 		{
 			Name:     "stdin_to_stdout",
@@ -35,6 +45,92 @@ func TestGunzip(t *testing.T) {
 				testutil.AssertFileExists(t, dir+"/input.txt")
 			},
 		},
+		{
+			Name:     "concatenated_stdin",
+			Args:     []string{},
+			Input:    concatenated,
+			WantOut:  "hello\nworld\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "concatenated_file",
+			Args:     []string{"both.gz"},
+			WantCode: core.ExitSuccess,
+			Files: map[string]string{
+				"both.gz": concatenated,
+			},
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileContent(t, dir+"/both", "hello\nworld\n")
+				testutil.AssertFileNotExists(t, dir+"/both.gz")
+			},
+		},
+		{
+			Name:     "trailing_garbage",
+			Args:     []string{"-c", "junk.gz"},
+			WantOut:  "hello\nworld\n",
+			WantErr:  "gunzip: junk.gz: decompression OK, trailing garbage ignored",
+			WantCode: core.ExitSuccess,
+			Files: map[string]string{
+				"junk.gz": concatenated + "not gzip data",
+			},
+		},
+		{
+			Name:     "trailing_bad_header",
+			Args:     []string{},
+			Input:    buf.String() + "\x1f\x8b\x00",
+			WantOut:  "hello\n",
+			WantErr:  "gunzip: stdin: decompression OK, trailing garbage ignored",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name: "recursive",
+			Args: []string{"-r", "tree"},
+			Files: map[string]string{
+				"tree/a.txt.gz":       buf.String(),
+				"tree/sub/b.gz":       second.String(),
+				"tree/sub/deep/c.tgz": buf.String(),
+				"tree/sub/plain.txt":  "left alone\n",
+			},
+			Setup: func(t *testing.T, dir string) {
+				if err := os.Symlink("a.txt.gz", filepath.Join(dir, "tree", "link.gz")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			WantCode: core.ExitSuccess,
+			WantErr:  "gunzip: tree/sub/plain.txt: unknown suffix - ignored",
+			Check: func(t *testing.T, dir string) {
+				var got []string
+				root := filepath.Join(dir, "tree")
+				_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+					if err == nil && !d.IsDir() {
+						rel, _ := filepath.Rel(root, path)
+						got = append(got, filepath.ToSlash(rel))
+					}
+					return err
+				})
+				sort.Strings(got)
+				want := "a.txt link.gz sub/b sub/deep/c.tar sub/plain.txt"
+				if strings.Join(got, " ") != want {
+					t.Errorf("tree after gunzip -r:\n got %s\nwant %s", strings.Join(got, " "), want)
+				}
+				testutil.AssertFileContent(t, filepath.Join(root, "sub/b"), "world\n")
+				if _, err := os.Lstat(filepath.Join(root, "link.gz")); err != nil {
+					t.Errorf("symlink should be left in place: %v", err)
+				}
+			},
+		},
+		{
+			Name:     "not_gzip",
+			Args:     []string{"plain.gz"},
+			WantErr:  "gunzip: plain.gz: not in gzip format",
+			WantCode: core.ExitFailure,
+			Files: map[string]string{
+				"plain.gz": "plain text\n",
+			},
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileNotExists(t, dir+"/plain")
+			},
+		},
 	}
 	testutil.RunAppletTests(t, gunzip.Run, tests)
 }
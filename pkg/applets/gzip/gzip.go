@@ -2,14 +2,24 @@
 package gzip
 
 import (
+	"bytes"
 	"compress/gzip"
+	"encoding/binary"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
 	corefs "github.com/rcarmo/go-busybox/pkg/core/fs"
 )
 
+// defaultLevel matches gzip(1); it is also what compress/flate uses for
+// DefaultCompression, but spelling it out keeps -1..-9 and the default on
+// the same scale.
+const defaultLevel = 6
+
 // Run executes the gzip command with the given arguments.
 //
 // Supported flags:
@@ -18,16 +28,30 @@ import (
 //	-d         Decompress (act like gunzip)
 //	-f         Force overwrite of output file
 //	-k         Keep (don't delete) input files
+//	-l         List compressed and uncompressed sizes, ratio and name
+//	-t         Test compressed file integrity
+//	-r         Compress the regular files below directory arguments
 //	-n         Do not save the original filename in the header
 //	-q         Suppress warnings
 //	-v         Verbose output
 //	-1 .. -9   Compression level (1=fastest, 9=best; default 6)
+//	--fast     Same as -1
+//	--best     Same as -9
+//
+// The long forms --stdout, --to-stdout, --keep, --list, --test,
+// --recursive, --force, --quiet, --verbose and --no-name are also
+// accepted. Input files are removed after compression unless -k or -c is
+// given. The -r walk does not follow symbolic links and leaves files that
+// already end in .gz unchanged.
 //
 // Reads from stdin when no files are given or when "-" is specified.
 func Run(stdio *core.Stdio, args []string) int {
 	toStdout := false
 	keep := false
-	level := gzip.DefaultCompression
+	list := false
+	test := false
+	recursive := false
+	level := defaultLevel
 	var files []string
 
 	for i := 0; i < len(args); i++ {
@@ -36,6 +60,28 @@ func Run(stdio *core.Stdio, args []string) int {
 			files = append(files, args[i+1:]...)
 			break
 		}
+		if strings.HasPrefix(arg, "--") {
+			switch arg {
+			case "--fast":
+				level = gzip.BestSpeed
+			case "--best":
+				level = gzip.BestCompression
+			case "--stdout", "--to-stdout":
+				toStdout = true
+			case "--keep":
+				keep = true
+			case "--list":
+				list = true
+			case "--test":
+				test = true
+			case "--recursive":
+				recursive = true
+			case "--force", "--quiet", "--verbose", "--no-name":
+			default:
+				return core.UsageError(stdio, "gzip", "unrecognized option '"+arg+"'")
+			}
+			continue
+		}
 		if len(arg) > 1 && arg[0] == '-' && arg != "-" {
 			for _, c := range arg[1:] {
 				switch c {
@@ -48,30 +94,20 @@ func Run(stdio *core.Stdio, args []string) int {
 					// force — ignore for now
 				case 'k':
 					keep = true
+				case 'l':
+					list = true
+				case 't':
+					test = true
+				case 'r':
+					recursive = true
 				case 'n':
 					// no-name — ignore
 				case 'q':
 					// quiet — ignore
 				case 'v':
 					// verbose — ignore
-				case '1':
-					level = gzip.BestSpeed
-				case '2':
-					level = 2
-				case '3':
-					level = 3
-				case '4':
-					level = 4
-				case '5':
-					level = 5
-				case '6':
-					level = 6
-				case '7':
-					level = 7
-				case '8':
-					level = 8
-				case '9':
-					level = gzip.BestCompression
+				case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+					level = int(c - '0')
 				default:
 					return core.UsageError(stdio, "gzip", "invalid option -- '"+string(c)+"'")
 				}
@@ -81,6 +117,13 @@ func Run(stdio *core.Stdio, args []string) int {
 		}
 	}
 
+	if list {
+		return listFiles(stdio, files)
+	}
+	if test {
+		return testFiles(stdio, files)
+	}
+
 	if len(files) == 0 {
 		// Read from stdin, write to stdout
 		return gzipStream(stdio.In, stdio.Out, level, stdio)
@@ -96,30 +139,72 @@ func Run(stdio *core.Stdio, args []string) int {
 			continue
 		}
 
-		if toStdout {
-			in, err := corefs.Open(path)
-			if err != nil {
-				stdio.Errorf("gzip: %v\n", err)
-				exitCode = core.ExitFailure
-				continue
-			}
-			if err := gzipStreamErr(in, stdio.Out, level); err != nil {
-				in.Close()
-				stdio.Errorf("gzip: %v\n", err)
-				exitCode = core.ExitFailure
-				continue
-			}
-			in.Close()
-		} else {
-			if err := gzipFile(path, level, keep); err != nil {
-				stdio.Errorf("gzip: %v\n", err)
-				exitCode = core.ExitFailure
-			}
+		if !compressPath(stdio, path, level, keep, toStdout, recursive) {
+			exitCode = core.ExitFailure
 		}
 	}
 	return exitCode
 }
 
+// compressPath compresses one file, or with recursive every regular
+// file below a directory. Symbolic links met during the walk are skipped
+// rather than followed. It reports whether everything succeeded.
+func compressPath(stdio *core.Stdio, path string, level int, keep, toStdout, recursive bool) bool {
+	info, err := corefs.Lstat(path)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		info, err = corefs.Stat(path)
+	}
+	if err != nil {
+		stdio.Errorf("gzip: %v\n", err)
+		return false
+	}
+	if info.IsDir() {
+		if !recursive {
+			stdio.Errorf("gzip: %s is a directory -- ignored\n", path)
+			return false
+		}
+		entries, err := corefs.ReadDir(path)
+		if err != nil {
+			stdio.Errorf("gzip: %v\n", err)
+			return false
+		}
+		ok := true
+		for _, entry := range entries {
+			child := filepath.Join(path, entry.Name())
+			switch {
+			case entry.IsDir():
+				ok = compressPath(stdio, child, level, keep, toStdout, recursive) && ok
+			case !entry.Type().IsRegular():
+				// Symlinks and special files are left alone.
+			case strings.HasSuffix(entry.Name(), ".gz"):
+				stdio.Errorf("gzip: %s already has .gz suffix -- unchanged\n", child)
+			default:
+				ok = compressPath(stdio, child, level, keep, toStdout, recursive) && ok
+			}
+		}
+		return ok
+	}
+
+	if toStdout {
+		in, err := corefs.Open(path)
+		if err != nil {
+			stdio.Errorf("gzip: %v\n", err)
+			return false
+		}
+		defer in.Close()
+		if err := gzipStreamErr(in, stdio.Out, level); err != nil {
+			stdio.Errorf("gzip: %v\n", err)
+			return false
+		}
+		return true
+	}
+	if err := gzipFile(path, level, keep); err != nil {
+		stdio.Errorf("gzip: %v\n", err)
+		return false
+	}
+	return true
+}
+
 func gzipStream(in io.Reader, out io.Writer, level int, stdio *core.Stdio) int {
 	if err := gzipStreamErr(in, out, level); err != nil {
 		stdio.Errorf("gzip: %v\n", err)
@@ -207,3 +292,161 @@ func gunzipStream(stdio *core.Stdio) int {
 	}
 	return core.ExitSuccess
 }
+
+// listHeader is the column header of gzip -l, as printed by GNU gzip.
+const listHeader = "         compressed        uncompressed  ratio uncompressed_name"
+
+// listing is one row of gzip -l output. overhead counts the header and
+// trailer bytes, which GNU gzip leaves out of the ratio.
+type listing struct {
+	compressed   int64
+	uncompressed int64
+	overhead     int64
+	name         string
+}
+
+// listFiles prints the gzip -l table. The uncompressed size is the ISIZE
+// field of the trailer, which holds the length modulo 2^32: it is wrong
+// for inputs of 4 GiB or more, and for multi-member files it only covers
+// the last member.
+func listFiles(stdio *core.Stdio, files []string) int {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	exitCode := core.ExitSuccess
+	var total listing
+	count := 0
+	for _, path := range files {
+		l, err := readListing(stdio, path)
+		if err != nil {
+			stdio.Errorf("gzip: %s: %s\n", path, describeError(err))
+			exitCode = core.ExitFailure
+			continue
+		}
+		if count == 0 {
+			stdio.Println(listHeader)
+		}
+		printListing(stdio, l)
+		total.compressed += l.compressed
+		total.uncompressed += l.uncompressed
+		total.overhead += l.overhead
+		count++
+	}
+	if count > 1 {
+		total.name = "(totals)"
+		printListing(stdio, total)
+	}
+	return exitCode
+}
+
+func printListing(stdio *core.Stdio, l listing) {
+	ratio := 0.0
+	if l.uncompressed > 0 {
+		deflated := l.compressed - l.overhead
+		ratio = 100 * float64(l.uncompressed-deflated) / float64(l.uncompressed)
+	}
+	stdio.Printf("%19d %19d %5.1f%% %s\n", l.compressed, l.uncompressed, ratio, l.name)
+}
+
+func readListing(stdio *core.Stdio, path string) (listing, error) {
+	var r io.ReaderAt
+	var size int64
+	if path == "-" {
+		data, err := io.ReadAll(stdio.In)
+		if err != nil {
+			return listing{}, err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	} else {
+		f, err := corefs.Open(path)
+		if err != nil {
+			return listing{}, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return listing{}, err
+		}
+		r, size = f, info.Size()
+	}
+	zr, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return listing{}, err
+	}
+	// Header and trailer are 10 and 8 bytes, plus the optional fields.
+	l := listing{compressed: size, overhead: 18, name: zr.Header.Name}
+	if len(zr.Header.Extra) > 0 {
+		l.overhead += int64(len(zr.Header.Extra)) + 2
+	}
+	if zr.Header.Name != "" {
+		l.overhead += int64(len(zr.Header.Name)) + 1
+	}
+	if zr.Header.Comment != "" {
+		l.overhead += int64(len(zr.Header.Comment)) + 1
+	}
+	if size < l.overhead {
+		return listing{}, io.ErrUnexpectedEOF
+	}
+	var isize [4]byte
+	if _, err := r.ReadAt(isize[:], size-4); err != nil {
+		return listing{}, err
+	}
+	l.uncompressed = int64(binary.LittleEndian.Uint32(isize[:]))
+	if l.name == "" {
+		l.name = strings.TrimSuffix(path, ".gz")
+	}
+	return l, nil
+}
+
+// testFiles decompresses each file to nowhere; the reader checks the
+// CRC and length in every trailer.
+func testFiles(stdio *core.Stdio, files []string) int {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	exitCode := core.ExitSuccess
+	for _, path := range files {
+		var err error
+		if path == "-" {
+			err = testStream(stdio.In)
+		} else {
+			var f *os.File
+			if f, err = corefs.Open(path); err == nil {
+				err = testStream(f)
+				f.Close()
+			}
+		}
+		if err != nil {
+			stdio.Errorf("gzip: %s: %s\n", path, describeError(err))
+			exitCode = core.ExitFailure
+		}
+	}
+	return exitCode
+}
+
+func testStream(in io.Reader) error {
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return err
+	}
+	return zr.Close()
+}
+
+// describeError words decompression errors the way gzip reports them.
+func describeError(err error) string {
+	var pathErr *os.PathError
+	switch {
+	case errors.As(err, &pathErr):
+		return pathErr.Err.Error()
+	case errors.Is(err, gzip.ErrHeader):
+		return "not in gzip format"
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return "unexpected end of file"
+	case errors.Is(err, gzip.ErrChecksum):
+		return "invalid compressed data--crc error"
+	}
+	return strings.TrimPrefix(err.Error(), "gzip: ")
+}
@@ -1,15 +1,29 @@
 package gzip_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
-	"github.com/rcarmo/go-busybox/pkg/applets/gzip"
+	gzipApplet "github.com/rcarmo/go-busybox/pkg/applets/gzip"
 	"github.com/rcarmo/go-busybox/pkg/core"
 	"github.com/rcarmo/go-busybox/pkg/testutil"
 )
 
+// knownArchive is "hello, hello, hello\n" compressed by Python's gzip
+// module with the original name hello.txt and a zero mtime.
+const knownArchive = "\x1f\x8b\x08\x08\x00\x00\x00\x00\x02\xff\x68\x65\x6c\x6c\x6f\x2e\x74\x78\x74\x00" +
+	"\xcb\x48\xcd\xc9\xc9\xd7\x51\xc8\x40\xa2\xb8\x00\xe7\x42\x6e\x52\x14\x00\x00\x00"
+
 func TestGzip(t *testing.T) {
+	corrupt := []byte(knownArchive)
+	corrupt[len(corrupt)-6] ^= 0xff // flip a CRC byte
 	tests := []testutil.AppletTestCase{
 		{
 			Name:     "stdin_to_stdout",
@@ -32,6 +46,228 @@ func TestGzip(t *testing.T) {
 				}
 			},
 		},
+		{
+			Name:     "keep",
+			Args:     []string{"-k", "input.txt"},
+			WantCode: core.ExitSuccess,
+			Files: map[string]string{
+				"input.txt": "hello\n",
+			},
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileExists(t, dir+"/input.txt.gz")
+				testutil.AssertFileContent(t, dir+"/input.txt", "hello\n")
+			},
+		},
+		{
+			Name:     "stdout_keeps_input",
+			Args:     []string{"-c", "input.txt"},
+			WantCode: core.ExitSuccess,
+			Files: map[string]string{
+				"input.txt": "hello\n",
+			},
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileNotExists(t, dir+"/input.txt.gz")
+				testutil.AssertFileContent(t, dir+"/input.txt", "hello\n")
+			},
+		},
+		{
+			Name: "list",
+			Args: []string{"-l", "known.gz"},
+			Files: map[string]string{
+				"known.gz": knownArchive,
+			},
+			WantCode: core.ExitSuccess,
+			WantOut: "         compressed        uncompressed  ratio uncompressed_name\n" +
+				"                 40                  20  40.0% hello.txt\n",
+		},
+		{
+			Name: "list_totals",
+			Args: []string{"-l", "a.gz", "b.gz"},
+			Files: map[string]string{
+				"a.gz": knownArchive,
+				"b.gz": knownArchive,
+			},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "                 80                  40  40.0% (totals)\n",
+		},
+		{
+			Name:     "list_not_gzip",
+			Args:     []string{"-l", "plain.txt"},
+			Files:    map[string]string{"plain.txt": "not compressed at all\n"},
+			WantCode: core.ExitFailure,
+			WantErr:  "gzip: plain.txt: not in gzip format",
+		},
+		{
+			Name:     "test_ok",
+			Args:     []string{"-t", "known.gz"},
+			Files:    map[string]string{"known.gz": knownArchive},
+			WantCode: core.ExitSuccess,
+			WantOut:  "",
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileNotExists(t, dir+"/known")
+				testutil.AssertFileExists(t, dir+"/known.gz")
+			},
+		},
+		{
+			Name:     "test_truncated",
+			Args:     []string{"-t", "short.gz"},
+			Files:    map[string]string{"short.gz": knownArchive[:30]},
+			WantCode: core.ExitFailure,
+			WantErr:  "gzip: short.gz: unexpected end of file",
+		},
+		{
+			Name:     "test_corrupted",
+			Args:     []string{"-t", "good.gz", "bad.gz"},
+			Files:    map[string]string{"good.gz": knownArchive, "bad.gz": string(corrupt)},
+			WantCode: core.ExitFailure,
+			WantErr:  "gzip: bad.gz: invalid compressed data--crc error",
+		},
+		{
+			Name:     "test_stdin",
+			Args:     []string{"-t"},
+			Input:    knownArchive,
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name: "recursive",
+			Args: []string{"-r", "tree"},
+			Files: map[string]string{
+				"tree/a.txt":          "a\n",
+				"tree/sub/b.txt":      "b\n",
+				"tree/sub/deep/c.txt": "c\n",
+				"tree/sub/done.gz":    knownArchive,
+			},
+			Setup: func(t *testing.T, dir string) {
+				if err := os.Symlink("a.txt", filepath.Join(dir, "tree", "link")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			WantCode: core.ExitSuccess,
+			WantErr:  "tree/sub/done.gz already has .gz suffix -- unchanged",
+			Check: func(t *testing.T, dir string) {
+				got := strings.Join(treeFiles(t, filepath.Join(dir, "tree")), " ")
+				want := "a.txt.gz link@ sub/b.txt.gz sub/deep/c.txt.gz sub/done.gz"
+				if got != want {
+					t.Errorf("tree after gzip -r:\n got %s\nwant %s", got, want)
+				}
+				testutil.AssertFileContent(t, filepath.Join(dir, "tree/sub/done.gz"), knownArchive)
+			},
+		},
+		{
+			Name:     "recursive_keep",
+			Args:     []string{"-rk", "tree"},
+			Files:    map[string]string{"tree/a.txt": "a\n"},
+			WantCode: core.ExitSuccess,
+			Check: func(t *testing.T, dir string) {
+				got := strings.Join(treeFiles(t, filepath.Join(dir, "tree")), " ")
+				if got != "a.txt a.txt.gz" {
+					t.Errorf("tree after gzip -rk: %s", got)
+				}
+			},
+		},
+		{
+			Name:     "directory_without_r",
+			Args:     []string{"tree"},
+			Files:    map[string]string{"tree/a.txt": "a\n"},
+			WantCode: core.ExitFailure,
+			WantErr:  "gzip: tree is a directory -- ignored",
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileExists(t, filepath.Join(dir, "tree/a.txt"))
+			},
+		},
+		{
+			Name:     "bad_long_option",
+			Args:     []string{"--fastest"},
+			WantCode: core.ExitUsage,
+			WantErr:  "unrecognized option",
+		},
+	}
+	testutil.RunAppletTests(t, gzipApplet.Run, tests)
+}
+
+// levelInput is text that compresses noticeably better at high levels.
+func levelInput() string {
+	var b strings.Builder
+	for i := 0; i < 4000; i++ {
+		fmt.Fprintf(&b, "line %d of %d: %s\n", i, i*i%977, strings.Repeat("ab", i%7))
+	}
+	return b.String()
+}
+
+func compressWith(t *testing.T, args ...string) []byte {
+	t.Helper()
+	input := levelInput()
+	out, errBuf, code := testutil.CaptureAndRun(t, gzipApplet.Run, args, input)
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	if errBuf.Len() > 0 {
+		t.Fatalf("unexpected stderr: %s", errBuf.String())
+	}
+	r, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("gzip %v: %v", args, err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != input {
+		t.Fatalf("gzip %v: round trip mismatch (err %v)", args, err)
+	}
+	return out.Bytes()
+}
+
+func TestGzipLevels(t *testing.T) {
+	fast := compressWith(t, "-1")
+	best := compressWith(t, "-9")
+	if len(best) >= len(fast) {
+		t.Errorf("-9 output (%d bytes) not smaller than -1 output (%d bytes)", len(best), len(fast))
+	}
+	if got := compressWith(t, "--fast"); !bytes.Equal(got, fast) {
+		t.Errorf("--fast output differs from -1")
+	}
+	if got := compressWith(t, "--best"); !bytes.Equal(got, best) {
+		t.Errorf("--best output differs from -9")
+	}
+	if got, want := compressWith(t), compressWith(t, "-6"); !bytes.Equal(got, want) {
+		t.Errorf("default level output differs from -6")
+	}
+	if got := compressWith(t, "-9", "-1"); !bytes.Equal(got, fast) {
+		t.Errorf("last level flag should win")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(path, []byte(levelInput()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, _, code := testutil.CaptureAndRun(t, gzipApplet.Run, []string{"-k9", path}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	data, err := os.ReadFile(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, best) {
+		t.Errorf("-k9 on a file differs from -9 on stdin")
+	}
+	testutil.AssertFileExists(t, path)
+}
+
+// treeFiles lists the non-directories below root as sorted slash paths,
+// marking symlinks with a trailing @.
+func treeFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.Type()&os.ModeSymlink != 0 {
+			rel += "@"
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
-	testutil.RunAppletTests(t, gzip.Run, tests)
+	sort.Strings(files)
+	return files
 }
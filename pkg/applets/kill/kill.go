@@ -2,6 +2,7 @@
 package kill
 
 import (
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -14,47 +15,99 @@ import (
 //
 // Usage:
 //
-//	kill [-SIGNAL] PID...
-//	kill -l
+//	kill [-SIGNAL | -s SIGNAL] PID...
+//	kill -l [SIGNAL]...
 //
 // Sends a signal to the specified processes. The default signal is SIGTERM.
-// The signal can be specified by name (e.g., -TERM, -9) or number.
-// Use -l to list all available signal names and numbers.
+// The signal can be given by name, with or without the SIG prefix and in
+// any case (-TERM, -sigterm, -s HUP), or by number (-9). Signal 0 sends
+// nothing and only checks that each process exists. A failure for one PID
+// is reported and the remaining PIDs are still signalled; the exit status
+// is then 1.
+//
+// With -l and no arguments every known signal is listed with its number.
+// With arguments, each number is translated to its name; a number above
+// 128, such as a shell exit status, is taken to mean 128+signal.
 func Run(stdio *core.Stdio, args []string) int {
 	if len(args) == 0 {
 		return core.UsageError(stdio, "kill", "missing pid")
 	}
 	if args[0] == "-l" {
-		printSignals(stdio)
-		return core.ExitSuccess
+		return listSignals(stdio, args[1:])
+	}
+	sig := syscall.SIGTERM
+	switch arg := args[0]; {
+	case arg == "--":
+		args = args[1:]
+	case arg == "-s":
+		if len(args) < 2 {
+			return core.UsageError(stdio, "kill", "option requires an argument -- 's'")
+		}
+		s, err := procutil.ParseSignal(args[1])
+		if err != nil {
+			stdio.Errorf("kill: bad signal name '%s'\n", args[1])
+			return core.ExitFailure
+		}
+		sig = s
+		args = args[2:]
+	case strings.HasPrefix(arg, "-") && arg != "-":
+		s, err := procutil.ParseSignal(arg)
+		if err != nil {
+			stdio.Errorf("kill: bad signal name '%s'\n", arg[1:])
+			return core.ExitFailure
+		}
+		sig = s
+		args = args[1:]
 	}
-	sig, err := procutil.ParseSignal(args[0])
-	if err == nil {
+	if len(args) > 0 && args[0] == "--" {
 		args = args[1:]
-	} else {
-		sig = syscall.SIGTERM
 	}
 	if len(args) == 0 {
 		return core.UsageError(stdio, "kill", "missing pid")
 	}
+	exitCode := core.ExitSuccess
 	for _, pidStr := range args {
 		pid, err := strconv.Atoi(pidStr)
 		if err != nil {
-			return core.UsageError(stdio, "kill", "invalid pid: "+pidStr)
+			stdio.Errorf("kill: invalid number '%s'\n", pidStr)
+			exitCode = core.ExitFailure
+			continue
 		}
 		if err := syscall.Kill(pid, sig); err != nil {
-			stdio.Errorf("kill: %v\n", err)
-			return core.ExitFailure
+			stdio.Errorf("kill: can't kill pid %d: %v\n", pid, err)
+			exitCode = core.ExitFailure
 		}
 	}
-	return core.ExitSuccess
+	return exitCode
 }
 
-func printSignals(stdio *core.Stdio) {
+// listSignals implements -l.
+func listSignals(stdio *core.Stdio, args []string) int {
 	names := procutil.SignalNames()
-	out := make([]string, 0, len(names))
-	for sig, name := range names {
-		out = append(out, strconv.Itoa(int(sig))+" "+name)
+	if len(args) == 0 {
+		sigs := make([]int, 0, len(names))
+		for sig := range names {
+			sigs = append(sigs, int(sig))
+		}
+		sort.Ints(sigs)
+		for _, sig := range sigs {
+			stdio.Printf("%2d) %s\n", sig, names[syscall.Signal(sig)])
+		}
+		return core.ExitSuccess
+	}
+	exitCode := core.ExitSuccess
+	for _, arg := range args {
+		num, err := strconv.Atoi(arg)
+		if num > 128 {
+			num -= 128
+		}
+		name, ok := names[syscall.Signal(num)]
+		if err != nil || !ok {
+			stdio.Errorf("kill: bad signal name '%s'\n", arg)
+			exitCode = core.ExitFailure
+			continue
+		}
+		stdio.Println(name)
 	}
-	stdio.Println(strings.Join(out, "\n"))
+	return exitCode
 }
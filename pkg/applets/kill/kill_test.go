@@ -0,0 +1,114 @@
+package kill_test
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/rcarmo/go-busybox/pkg/applets/kill"
+	"github.com/rcarmo/go-busybox/pkg/core"
+	"github.com/rcarmo/go-busybox/pkg/testutil"
+)
+
+func TestKill(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "missing",
+			Args:     []string{},
+			WantCode: core.ExitUsage,
+		},
+		{
+			Name:     "missing_after_signal",
+			Args:     []string{"-9"},
+			WantCode: core.ExitUsage,
+		},
+		{
+			Name:       "list",
+			Args:       []string{"-l"},
+			WantOutSub: " 9) KILL\n",
+			WantCode:   core.ExitSuccess,
+		},
+		{
+			Name:     "list_number",
+			Args:     []string{"-l", "15", "1"},
+			WantOut:  "TERM\nHUP\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "list_exit_status",
+			Args:     []string{"-l", "137"},
+			WantOut:  "KILL\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "list_unknown",
+			Args:     []string{"-l", "bogus"},
+			WantErr:  "bad signal name 'bogus'",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "exists",
+			Args:     []string{"-0", self},
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "exists_by_name",
+			Args:     []string{"-s", "0", self},
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "continues_after_failure",
+			Args:     []string{"-0", "abc", "2147483647", self},
+			WantErr:  "kill: can't kill pid 2147483647",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "bad_signal",
+			Args:     []string{"-NOPE", self},
+			WantErr:  "bad signal name 'NOPE'",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "s_missing_argument",
+			Args:     []string{"-s"},
+			WantCode: core.ExitUsage,
+		},
+	}
+	testutil.RunAppletTests(t, kill.Run, tests)
+}
+
+func TestKillSignals(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want syscall.Signal
+	}{
+		{nil, syscall.SIGTERM},
+		{[]string{"-9"}, syscall.SIGKILL},
+		{[]string{"-HUP"}, syscall.SIGHUP},
+		{[]string{"-sigint"}, syscall.SIGINT},
+		{[]string{"-s", "usr1"}, syscall.SIGUSR1},
+		{[]string{"-s", "SIGUSR2"}, syscall.SIGUSR2},
+	} {
+		t.Run(strings.Join(append([]string{"kill"}, tc.args...), " "), func(t *testing.T) {
+			cmd := exec.Command("sleep", "30")
+			if err := cmd.Start(); err != nil {
+				t.Skipf("cannot start sleep: %v", err)
+			}
+			args := append(append([]string(nil), tc.args...), strconv.Itoa(cmd.Process.Pid))
+			_, errBuf, code := testutil.CaptureAndRun(t, kill.Run, args, "")
+			if code != core.ExitSuccess {
+				_ = cmd.Process.Kill()
+				t.Fatalf("exit code %d: %s", code, errBuf)
+			}
+			err := cmd.Wait()
+			status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+			if !ok || !status.Signaled() || status.Signal() != tc.want {
+				t.Errorf("child ended with %v, want signal %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,280 @@
-// Package killall implements killall using pgrep matching.
+// Package killall implements the killall command.
 package killall
 
 import (
-	"github.com/rcarmo/go-busybox/pkg/applets/pgrep"
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rcarmo/go-busybox/pkg/applets/procutil"
 	"github.com/rcarmo/go-busybox/pkg/core"
 )
 
+// commLen is the longest name the kernel keeps in /proc/PID/comm.
+const commLen = 15
+
+// waitPoll is how often -w checks whether signalled processes are gone.
+const waitPoll = 50 * time.Millisecond
+
+type options struct {
+	signal      syscall.Signal
+	regex       bool
+	exact       bool
+	interactive bool
+	wait        bool
+	quiet       bool
+	user        string
+}
+
 // Run executes the killall command with the given arguments.
 //
-// killall sends a signal (default SIGTERM) to all processes matching
-// the given name pattern. It delegates to the pgrep implementation
-// with signal-sending enabled.
+// Usage:
+//
+//	killall [-eiqrw] [-u USER] [-s SIGNAL | -SIGNAL] NAME...
+//
+// Supported flags:
+//
+//	-e, --exact        Match the full process name, even past 15 characters
+//	-i, --interactive  Ask before signalling each process
+//	-q, --quiet        Do not complain when no process matches
+//	-r, --regex        Treat NAME as an extended regular expression
+//	-u, --user USER    Only signal processes owned by USER (name or UID)
+//	-w, --wait         Wait until every signalled process has exited
+//	-s, --signal SIG   Send SIG instead of SIGTERM; -SIG also works
+//
+// Names are compared with the process name in /proc/PID/comm, which the
+// kernel cuts to 15 characters; without -e a longer NAME matches on its
+// first 15 characters. With -e the name must equal the base name of the
+// program in the command line. A regex is searched for in the same name.
+//
+// Every NAME must match at least one process. For each one that does
+// not, "no process found" is reported and the exit status is 1; with -q
+// nothing is reported and such names do not affect the exit status.
 func Run(stdio *core.Stdio, args []string) int {
-	// killall matches process names (comm) and sends TERM by default.
-	return pgrep.Run(stdio, append([]string{"-s", "TERM"}, args...))
+	opts := options{signal: syscall.SIGTERM}
+	var names []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			names = append(names, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			names = append(names, arg)
+			continue
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg, "=")
+			switch name {
+			case "--exact":
+				opts.exact = true
+			case "--interactive":
+				opts.interactive = true
+			case "--quiet":
+				opts.quiet = true
+			case "--regex":
+				opts.regex = true
+			case "--wait":
+				opts.wait = true
+			case "--user", "--signal":
+				if !hasValue {
+					if i+1 >= len(args) {
+						return core.UsageError(stdio, "killall", "option '"+name+"' requires an argument")
+					}
+					i++
+					value = args[i]
+				}
+				if code := opts.set(stdio, name[2:3], value); code != core.ExitSuccess {
+					return code
+				}
+			default:
+				return core.UsageError(stdio, "killall", "unrecognized option '"+arg+"'")
+			}
+			continue
+		}
+		switch {
+		case arg == "-s" || arg == "-u":
+			if i+1 >= len(args) {
+				return core.UsageError(stdio, "killall", "option requires an argument -- '"+arg[1:]+"'")
+			}
+			i++
+			if code := opts.set(stdio, arg[1:], args[i]); code != core.ExitSuccess {
+				return code
+			}
+		case strings.Trim(arg[1:], "eiqrw") == "":
+			for _, c := range arg[1:] {
+				switch c {
+				case 'e':
+					opts.exact = true
+				case 'i':
+					opts.interactive = true
+				case 'q':
+					opts.quiet = true
+				case 'r':
+					opts.regex = true
+				case 'w':
+					opts.wait = true
+				}
+			}
+		default:
+			sig, err := procutil.ParseSignal(arg)
+			if err != nil {
+				return core.UsageError(stdio, "killall", "invalid option -- '"+arg[1:]+"'")
+			}
+			opts.signal = sig
+		}
+	}
+	if len(names) == 0 {
+		return core.UsageError(stdio, "killall", "no process name specified")
+	}
+
+	matchers := make([]func(comm, long string) bool, len(names))
+	for i, name := range names {
+		m, err := newMatcher(name, opts)
+		if err != nil {
+			stdio.Errorf("killall: bad regular expression '%s': %v\n", name, err)
+			return core.ExitFailure
+		}
+		matchers[i] = m
+	}
+
+	procs := procutil.ListProcesses()
+	procutil.SortByPID(procs)
+	self := os.Getpid()
+	found := make([]bool, len(names))
+	var signalled []procutil.ProcInfo
+	var answers *bufio.Reader
+	exitCode := core.ExitSuccess
+	for _, proc := range procs {
+		if proc.PID == self || proc.Comm == "" {
+			continue
+		}
+		if opts.user != "" && opts.user != proc.UID && opts.user != procutil.LookupUser(proc.UID) {
+			continue
+		}
+		long := longName(proc)
+		matched := false
+		for i, match := range matchers {
+			if match(proc.Comm, long) {
+				found[i] = true
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+		if opts.interactive {
+			if answers == nil {
+				answers = bufio.NewReader(stdio.In)
+			}
+			stdio.Errorf("Kill %s(%d) ? (y/N) ", proc.Comm, proc.PID)
+			reply, _ := answers.ReadString('\n')
+			if reply = strings.TrimSpace(reply); reply != "y" && reply != "Y" {
+				continue
+			}
+		}
+		if err := syscall.Kill(proc.PID, opts.signal); err != nil {
+			stdio.Errorf("killall: %s(%d): %v\n", proc.Comm, proc.PID, err)
+			exitCode = core.ExitFailure
+			continue
+		}
+		signalled = append(signalled, proc)
+	}
+	for i, name := range names {
+		if !found[i] && !opts.quiet {
+			stdio.Errorf("killall: %s: no process found\n", name)
+			exitCode = core.ExitFailure
+		}
+	}
+	if opts.wait && opts.signal != 0 {
+		waitForExit(signalled)
+	}
+	return exitCode
+}
+
+// set applies the value of -s or -u.
+func (o *options) set(stdio *core.Stdio, flag, value string) int {
+	if flag == "u" {
+		o.user = value
+		return core.ExitSuccess
+	}
+	sig, err := procutil.ParseSignal(value)
+	if err != nil {
+		return core.UsageError(stdio, "killall", "unknown signal '"+value+"'")
+	}
+	o.signal = sig
+	return core.ExitSuccess
+}
+
+// newMatcher returns the test applied to each process for NAME.
+func newMatcher(name string, opts options) (func(comm, long string) bool, error) {
+	if opts.regex {
+		re, err := regexp.Compile(name)
+		if err != nil {
+			return nil, err
+		}
+		return func(comm, long string) bool {
+			if opts.exact {
+				return re.MatchString(long)
+			}
+			return re.MatchString(comm)
+		}, nil
+	}
+	return func(comm, long string) bool {
+		switch {
+		case len(name) < commLen:
+			// comm cannot have been cut short.
+			return comm == name
+		case opts.exact:
+			return long == name
+		}
+		return comm == name[:commLen]
+	}, nil
+}
+
+// longName is the untruncated program name: the base name of the first
+// word of the command line, or comm for kernel threads, which have none.
+func longName(proc procutil.ProcInfo) string {
+	if proc.Args == "" {
+		return proc.Comm
+	}
+	argv0, _, _ := strings.Cut(proc.Args, " ")
+	return filepath.Base(argv0)
+}
+
+// waitForExit blocks until none of procs is still running. A process
+// that has exited but not yet been reaped by its parent counts as gone.
+func waitForExit(procs []procutil.ProcInfo) {
+	for len(procs) > 0 {
+		alive := procs[:0]
+		for _, proc := range procs {
+			if running(proc.PID) {
+				alive = append(alive, proc)
+			}
+		}
+		procs = alive
+		if len(procs) > 0 {
+			time.Sleep(waitPoll)
+		}
+	}
+}
+
+func running(pid int) bool {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesised command name, which may
+	// itself contain spaces or parentheses.
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 || end+2 >= len(data) {
+		return true
+	}
+	state := data[end+2]
+	return state != 'Z' && state != 'X'
 }
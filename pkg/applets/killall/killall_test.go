@@ -1,7 +1,15 @@
 package killall_test
 
 import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/killall"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -24,3 +32,172 @@ func TestKillallInvalid(t *testing.T) {
 	}
 	testutil.RunAppletTests(t, killall.Run, tests)
 }
+
+// spawn starts a copy of sleep under the given name so that killall
+// only ever matches processes the test owns.
+func spawn(t *testing.T, name string) *exec.Cmd {
+	t.Helper()
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	data, err := os.ReadFile(sleep)
+	if err != nil {
+		t.Skipf("cannot copy sleep: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(path, "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot run copied sleep: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	// Wait for the exec to finish so /proc shows the new name.
+	want := name
+	if len(want) > 15 {
+		want = want[:15]
+	}
+	commPath := filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "comm")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if comm, _ := os.ReadFile(commPath); strings.TrimSpace(string(comm)) == want {
+			return cmd
+		}
+	}
+	t.Fatalf("%s did not start", name)
+	return nil
+}
+
+// signalledBy waits for cmd and returns the signal that ended it, or 0
+// if it is still running.
+func signalledBy(t *testing.T, cmd *exec.Cmd) syscall.Signal {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		_ = cmd.Process.Kill()
+		<-done
+		return 0
+	}
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		t.Fatalf("process exited without a signal: %v", cmd.ProcessState)
+	}
+	return status.Signal()
+}
+
+func TestKillall(t *testing.T) {
+	name := "kat" + strconv.Itoa(os.Getpid())
+	me, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		input string
+		want  syscall.Signal
+		code  int
+	}{
+		{"default_term", []string{name}, "", syscall.SIGTERM, core.ExitSuccess},
+		{"dash_signal", []string{"-KILL", name}, "", syscall.SIGKILL, core.ExitSuccess},
+		{"dash_number", []string{"-9", name}, "", syscall.SIGKILL, core.ExitSuccess},
+		{"s_signal", []string{"-s", "hup", name}, "", syscall.SIGHUP, core.ExitSuccess},
+		{"long_signal", []string{"--signal=SIGUSR1", name}, "", syscall.SIGUSR1, core.ExitSuccess},
+		{"substring_does_not_match", []string{name[:len(name)-1]}, "", 0, core.ExitFailure},
+		{"regex", []string{"-r", "^kat[0-9]+$", name}, "", syscall.SIGTERM, core.ExitSuccess},
+		{"regex_no_match", []string{"-r", "^xkat"}, "", 0, core.ExitFailure},
+		{"user", []string{"-u", me.Username, name}, "", syscall.SIGTERM, core.ExitSuccess},
+		{"uid", []string{"--user", me.Uid, name}, "", syscall.SIGTERM, core.ExitSuccess},
+		{"other_user", []string{"-u", "no-such-user-here", name}, "", 0, core.ExitFailure},
+		{"interactive_yes", []string{"-i", name}, "y\n", syscall.SIGTERM, core.ExitSuccess},
+		{"interactive_no", []string{"-i", name}, "n\n", 0, core.ExitSuccess},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := spawn(t, name)
+			_, errBuf, code := testutil.CaptureAndRun(t, killall.Run, tc.args, tc.input)
+			if code != tc.code {
+				t.Errorf("exit code %d, want %d (stderr %q)", code, tc.code, errBuf)
+			}
+			if got := signalledBy(t, cmd); got != tc.want {
+				t.Errorf("process got signal %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKillallLongName(t *testing.T) {
+	long := "katlongname" + strconv.Itoa(os.Getpid())
+	other := long[:15] + "-other"
+	for _, tc := range []struct {
+		name string
+		args []string
+		want syscall.Signal
+	}{
+		{"prefix_without_e", []string{other}, syscall.SIGTERM},
+		{"exact_name", []string{"-e", long}, syscall.SIGTERM},
+		{"exact_other", []string{"-e", other}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := spawn(t, long)
+			testutil.CaptureAndRun(t, killall.Run, tc.args, "")
+			if got := signalledBy(t, cmd); got != tc.want {
+				t.Errorf("process got signal %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKillallNoProcess(t *testing.T) {
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "not_found",
+			Args:     []string{"no-such-process"},
+			WantErr:  "killall: no-such-process: no process found",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "quiet",
+			Args:     []string{"-q", "no-such-process"},
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "bad_regex",
+			Args:     []string{"-r", "("},
+			WantErr:  "bad regular expression",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "bad_signal",
+			Args:     []string{"-s", "NOPE", "x"},
+			WantCode: core.ExitUsage,
+		},
+	}
+	testutil.RunAppletTests(t, killall.Run, tests)
+}
+
+func TestKillallWait(t *testing.T) {
+	name := "katw" + strconv.Itoa(os.Getpid())
+	cmd := spawn(t, name)
+	if _, errBuf, code := testutil.CaptureAndRun(t, killall.Run, []string{"-w", name}, ""); code != core.ExitSuccess {
+		t.Fatalf("exit code %d: %s", code, errBuf)
+	}
+	// killall -w returns only once the process has exited; it is left
+	// as a zombie until the test reaps it.
+	stat, _ := os.ReadFile(filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "stat"))
+	if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] != "Z" {
+		t.Errorf("process state %s after killall -w, want exited", fields[2])
+	}
+	if got := signalledBy(t, cmd); got != syscall.SIGTERM {
+		t.Errorf("process got signal %v, want TERM", got)
+	}
+}
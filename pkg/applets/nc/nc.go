@@ -5,25 +5,59 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
 )
 
+type ncOptions struct {
+	listen    bool
+	keepOpen  bool
+	localPort string
+	execArgs  []string
+}
+
 // Run executes the nc (netcat) command with the given arguments.
 //
 // Usage:
 //
-//	nc HOST PORT
+//	nc [-p PORT] HOST PORT [-e PROG [ARGS...]]
+//	nc -l [-k] [-p PORT] [HOST] [PORT] [-e PROG [ARGS...]]
+//
+// Supported flags:
+//
+//	-l          Listen for an incoming connection instead of connecting
+//	-k          With -l, keep listening after a connection closes
+//	-p PORT     Local port to listen on
+//	-e PROG     Run PROG with its stdin/stdout/stderr wired to the socket;
+//	            must be last, remaining arguments are passed to PROG
 //
-// Opens a TCP connection to HOST:PORT, copies stdin to the connection
-// and the connection output to stdout. No flags are supported.
+// Without -e, nc copies stdin to the connection and the connection output
+// to stdout.
+//
+// Security: -e hands the socket directly to PROG. In listen mode anyone
+// able to reach the port can drive PROG with arbitrary input, so exposing
+// a shell this way grants remote command execution to the network. nc
+// prints a warning to stderr whenever -e is combined with -l. Each
+// accepted connection gets its own child process; the child is reaped
+// when it exits, the socket is closed as soon as the child exits, and a
+// peer hang-up closes the child's stdin and sends it SIGHUP. -e is not
+// available in WASM builds.
 func Run(stdio *core.Stdio, args []string) int {
-	if len(args) < 2 {
+	opts, positional, code := parseArgs(stdio, args)
+	if code != core.ExitSuccess {
+		return code
+	}
+	if opts.listen {
+		return runListen(stdio, opts, positional)
+	}
+	if len(positional) < 2 {
 		return core.UsageError(stdio, "nc", "missing host or port")
 	}
-	host := args[0]
-	port := args[1]
+	host := positional[0]
+	port := positional[1]
 	if _, err := strconv.Atoi(port); err != nil {
 		return core.UsageError(stdio, "nc", "invalid port")
 	}
@@ -33,7 +67,135 @@ func Run(stdio *core.Stdio, args []string) int {
 		return core.ExitFailure
 	}
 	defer conn.Close()
+	if len(opts.execArgs) > 0 {
+		return serveExec(stdio, conn, opts.execArgs)
+	}
 	_ = conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	return relay(stdio, conn)
+}
+
+func parseArgs(stdio *core.Stdio, args []string) (ncOptions, []string, int) {
+	opts := ncOptions{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		flags := arg[1:]
+		for j := 0; j < len(flags); j++ {
+			switch flags[j] {
+			case 'l':
+				opts.listen = true
+			case 'k':
+				opts.keepOpen = true
+			case 'p':
+				val := flags[j+1:]
+				if val == "" {
+					if i+1 >= len(args) {
+						return opts, nil, core.UsageError(stdio, "nc", "option requires an argument -- 'p'")
+					}
+					i++
+					val = args[i]
+				}
+				if _, err := strconv.Atoi(val); err != nil {
+					return opts, nil, core.UsageError(stdio, "nc", "invalid port")
+				}
+				opts.localPort = val
+				j = len(flags)
+			case 'e':
+				// -e consumes the rest of the command line as PROG [ARGS...].
+				rest := args[i+1:]
+				if val := flags[j+1:]; val != "" {
+					rest = append([]string{val}, rest...)
+				}
+				if len(rest) == 0 {
+					return opts, nil, core.UsageError(stdio, "nc", "option requires an argument -- 'e'")
+				}
+				opts.execArgs = rest
+				return opts, positional, core.ExitSuccess
+			default:
+				return opts, nil, core.UsageError(stdio, "nc", "invalid option -- '"+string(flags[j])+"'")
+			}
+		}
+	}
+	return opts, positional, core.ExitSuccess
+}
+
+func runListen(stdio *core.Stdio, opts ncOptions, positional []string) int {
+	host := ""
+	port := opts.localPort
+	switch len(positional) {
+	case 0:
+	case 1:
+		if port == "" {
+			port = positional[0]
+		} else {
+			host = positional[0]
+		}
+	default:
+		host = positional[0]
+		if port == "" {
+			port = positional[1]
+		}
+	}
+	if port == "" {
+		return core.UsageError(stdio, "nc", "missing port")
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return core.UsageError(stdio, "nc", "invalid port")
+	}
+	if len(opts.execArgs) > 0 {
+		stdio.Errorf("nc: warning: -e gives every peer direct access to %s\n", opts.execArgs[0])
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		stdio.Errorf("nc: %v\n", err)
+		return core.ExitFailure
+	}
+	defer ln.Close()
+	if !opts.keepOpen {
+		conn, err := ln.Accept()
+		if err != nil {
+			stdio.Errorf("nc: %v\n", err)
+			return core.ExitFailure
+		}
+		defer conn.Close()
+		if len(opts.execArgs) > 0 {
+			return serveExec(stdio, conn, opts.execArgs)
+		}
+		return relay(stdio, conn)
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			stdio.Errorf("nc: %v\n", err)
+			return core.ExitFailure
+		}
+		if len(opts.execArgs) == 0 {
+			relay(stdio, conn)
+			_ = conn.Close()
+			continue
+		}
+		// Each connection gets its own child; the WaitGroup ensures every
+		// child is reaped before nc returns.
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			defer conn.Close()
+			serveExec(stdio, conn, opts.execArgs)
+		}(conn)
+	}
+}
+
+func relay(stdio *core.Stdio, conn net.Conn) int {
 	go func() {
 		_, _ = io.Copy(conn, stdio.In)
 	}()
@@ -0,0 +1,53 @@
+//go:build !js && !wasm && !wasip1
+
+package nc
+
+import (
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/rcarmo/go-busybox/pkg/core"
+)
+
+// serveExec runs argv with its stdio wired to conn and returns the child's
+// exit status. The socket is closed once the child exits; if the peer hangs
+// up first, the child's stdin is closed and it is sent SIGHUP.
+func serveExec(stdio *core.Stdio, conn net.Conn, argv []string) int {
+	cmd := exec.Command(argv[0], argv[1:]...) // #nosec G204 -- nc -e runs user-provided command
+	cmd.Stdout = conn
+	cmd.Stderr = conn
+	cmd.Env = os.Environ()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		stdio.Errorf("nc: %v\n", err)
+		return core.ExitFailure
+	}
+	if err := cmd.Start(); err != nil {
+		stdio.Errorf("nc: %v\n", err)
+		return core.ExitFailure
+	}
+	exited := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(stdin, conn)
+		_ = stdin.Close()
+		select {
+		case <-exited:
+		default:
+			_ = cmd.Process.Signal(syscall.SIGHUP)
+		}
+	}()
+	err = cmd.Wait()
+	close(exited)
+	_ = conn.Close()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		stdio.Errorf("nc: %v\n", err)
+		return core.ExitFailure
+	}
+	return core.ExitSuccess
+}
@@ -0,0 +1,15 @@
+//go:build js || wasm || wasip1
+
+package nc
+
+import (
+	"net"
+
+	"github.com/rcarmo/go-busybox/pkg/core"
+)
+
+// serveExec is a stub; running programs is unsupported on WASM platforms.
+func serveExec(stdio *core.Stdio, conn net.Conn, argv []string) int {
+	stdio.Errorf("nc: -e not supported in wasm\n")
+	return core.ExitFailure
+}
@@ -2,8 +2,10 @@ package nc_test
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/nc"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -43,3 +45,67 @@ func TestNc(t *testing.T) {
 	}
 	testutil.RunAppletTests(t, nc.Run, tests)
 }
+
+func TestNcExec(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- ""
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		got <- string(data)
+	}()
+	port := fmt.Sprintf("%d", ln.Addr().(*net.TCPAddr).Port)
+	_, _, code := testutil.CaptureAndRun(t, nc.Run, []string{"127.0.0.1", port, "-e", "echo", "hello"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	testutil.AssertOutput(t, <-got, "hello\n")
+}
+
+func TestNcListenExec(t *testing.T) {
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := fmt.Sprintf("%d", probe.Addr().(*net.TCPAddr).Port)
+	_ = probe.Close()
+	done := make(chan int, 1)
+	stdio, _, errBuf := testutil.CaptureStdio("")
+	go func() {
+		done <- nc.Run(stdio, []string{"-l", "-p", port, "127.0.0.1", "-e", "cat"})
+	}()
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial("tcp", "127.0.0.1:"+port)
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	testutil.AssertOutput(t, string(buf), "ping\n")
+	_ = conn.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nc did not exit after the peer hung up")
+	}
+	testutil.AssertOutputContains(t, errBuf.String(), "warning")
+}
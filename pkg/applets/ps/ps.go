@@ -10,56 +10,93 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/procutil"
 	"github.com/rcarmo/go-busybox/pkg/core"
+	"golang.org/x/term"
+)
+
+// clockTicks is USER_HZ, the unit of the times in /proc/PID/stat.
+const clockTicks = 100
+
+type outputFormat int
+
+const (
+	formatDefault outputFormat = iota
+	formatUser                 // BSD "u": USER PID %CPU %MEM ...
+	formatFull                 // SysV "-f": UID PID PPID C STIME ...
 )
 
 type options struct {
 	columns string
 	threads bool
+	format  outputFormat
+	wide    bool
+	sort    string
+	forest  bool
 }
 
 type procInfo struct {
-	pid    int
-	user   string
-	group  string
-	comm   string
-	args   string
-	ppid   int
-	pgid   int
-	sid    int
-	ttyNr  int
-	stat   string
-	nice   int
-	vszKB  int
-	rssKB  int
-	ttyStr string
+	pid      int
+	uid      string
+	user     string
+	group    string
+	comm     string
+	args     string
+	ppid     int
+	pgid     int
+	sid      int
+	ttyNr    int
+	tpgid    int
+	state    string
+	stat     string
+	nice     int
+	priority int
+	threads  int
+	vszKB    int
+	rssKB    int
+	ttyStr   string
+	cpuTime  time.Duration
+	startup  time.Duration // start time, measured from boot
+	started  time.Time
+	pcpu     float64
+	pmem     float64
+	forest   string // --forest indentation for the command column
 }
 
 // Run executes the ps command with the given arguments.
 //
 // Supported flags:
 //
-//	-o FMT    Specify output format columns (comma-separated)
+//	-o FMT    Specify output format columns (comma-separated); FIELD=HEADER
+//	          renames a column, and -o replaces the default columns
+//	--sort=[+-]FIELD[,...]  Order rows by the given fields; - reverses
+//	--forest  Show processes as a tree (also the BSD f option)
 //	-T        Show threads
+//	-f        Full format: UID PID PPID C STIME TTY TIME CMD
+//	-w        Wide output; do not truncate COMMAND
+//	-e, -A    Show all processes (accepted for compatibility)
 //	-a        Show all processes (accepted for compatibility)
 //	-Z        (accepted for compatibility, ignored)
 //
+// BSD-style option words without a dash are also accepted: a and x
+// select all processes, u selects the user-oriented format (USER PID
+// %CPU %MEM VSZ RSS TTY STAT START TIME COMMAND), and w disables
+// truncation, so "ps aux" and "ps -ef" both work.
+//
 // Default output columns are PID, USER, and COMMAND. Custom formats
-// support: pid, ppid, pgid, uid, user, gid, group, tty, vsz, rss,
-// stat, comm, args, nice, etime, time, and %cpu.
+// and sort keys support: pid, ppid, pgid, sid, uid, user, ruser, group,
+// rgroup, tty, vsz, rss, stat, comm, args, nice, pri, etime, time,
+// pcpu (%cpu), and pmem (%mem). Numeric fields sort numerically.
+//
+// When stdout is a terminal, or COLUMNS is set, lines are cut at the
+// terminal width unless -w is given.
 func Run(stdio *core.Stdio, args []string) int {
 	opts := options{}
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
-		if arg == "-T" {
-			opts.threads = true
-			continue
-		}
-		if arg == "-a" || arg == "-Z" {
-			continue
-		}
 		if arg == "-o" {
 			if i+1 >= len(args) {
 				stdio.Errorf("ps: option requires an argument -- 'o'\n")
@@ -71,26 +108,195 @@ func Run(stdio *core.Stdio, args []string) int {
 				return core.ExitFailure
 			}
 			i++
-			opts.columns = args[i]
+			opts.addColumns(args[i])
+			continue
+		}
+		if arg == "--forest" {
+			opts.forest = true
+			continue
+		}
+		if arg == "--sort" || strings.HasPrefix(arg, "--sort=") {
+			value, ok := strings.CutPrefix(arg, "--sort=")
+			if !ok {
+				if i+1 >= len(args) {
+					return core.UsageError(stdio, "ps", "option '--sort' requires an argument")
+				}
+				i++
+				value = args[i]
+			}
+			opts.sort = value
+			continue
+		}
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			if strings.HasPrefix(arg, "-o") {
+				opts.addColumns(arg[2:])
+				continue
+			}
+			for _, c := range arg[1:] {
+				switch c {
+				case 'T':
+					opts.threads = true
+				case 'f':
+					opts.format = formatFull
+				case 'w':
+					opts.wide = true
+				case 'a', 'e', 'A', 'Z':
+				default:
+					return core.UsageError(stdio, "ps", "invalid option -- '"+string(c)+"'")
+				}
+			}
 			continue
 		}
-		if strings.HasPrefix(arg, "-") {
-			return core.UsageError(stdio, "ps", "invalid option -- '"+strings.TrimPrefix(arg, "-")+"'")
+		for _, c := range arg {
+			switch c {
+			case 'u':
+				opts.format = formatUser
+			case 'f':
+				opts.forest = true
+			case 'w':
+				opts.wide = true
+			case 'a', 'x':
+			default:
+				return core.UsageError(stdio, "ps", "unsupported option '"+string(c)+"'")
+			}
 		}
 	}
 
 	procs := listProcesses(opts.threads)
-	if opts.columns != "" {
-		return printCustom(stdio, procs, opts.columns)
+	if opts.sort != "" {
+		keys, invalid := parseSort(opts.sort)
+		if invalid != "" || len(keys) == 0 {
+			stdio.Errorf("ps: unknown sort key '%s', supported keys: %s\n", invalid, supportedColumns)
+			return core.ExitFailure
+		}
+		sortProcs(procs, keys)
+	}
+	if opts.forest {
+		procs = forestOrder(procs)
+	}
+	width := 0
+	if !opts.wide {
+		width = outputWidth(stdio)
+	}
+	var cols []columnSpec
+	switch {
+	case opts.columns != "":
+		var invalid string
+		cols, invalid = parseColumns(opts.columns)
+		if invalid != "" {
+			stdio.Errorf("ps: bad -o argument '%s', supported arguments: %s\n", invalid, supportedColumns)
+			return core.ExitFailure
+		}
+	case opts.format == formatUser:
+		cols = userColumns()
+	case opts.format == formatFull:
+		cols = fullColumns()
+	default:
+		cols = defaultColumns()
 	}
 
-	stdio.Println(formatHeader(defaultColumns()))
+	stdio.Println(fitWidth(formatHeader(cols), width))
 	for _, p := range procs {
-		stdio.Println(formatRow(defaultColumns(), p))
+		stdio.Println(fitWidth(formatRow(cols, p), width))
 	}
 	return core.ExitSuccess
 }
 
+// addColumns appends an -o list; repeated -o options accumulate.
+func (o *options) addColumns(spec string) {
+	if o.columns != "" {
+		spec = o.columns + "," + spec
+	}
+	o.columns = spec
+}
+
+// forestOrder arranges procs as a tree built from their PPIDs and sets
+// the indentation drawn before each command. A process whose parent is
+// not listed becomes a root, except that orphans are shown under PID 1
+// when it is listed, so a filtered set keeps its relative indentation.
+// Roots keep their order in procs; children are ordered by PID.
+func forestOrder(procs []procInfo) []procInfo {
+	index := make(map[int]int, len(procs))
+	for i, p := range procs {
+		index[p.pid] = i
+	}
+	_, haveInit := index[1]
+	children := make(map[int][]int)
+	var roots []int
+	for i, p := range procs {
+		parent := p.ppid
+		if _, ok := index[parent]; !ok && haveInit && parent != 0 && p.pid != 1 {
+			parent = 1
+		}
+		if _, ok := index[parent]; !ok || parent == p.pid {
+			roots = append(roots, i)
+			continue
+		}
+		children[parent] = append(children[parent], i)
+	}
+	for _, kids := range children {
+		sort.Slice(kids, func(a, b int) bool { return procs[kids[a]].pid < procs[kids[b]].pid })
+	}
+
+	out := make([]procInfo, 0, len(procs))
+	seen := make(map[int]bool, len(procs))
+	var walk func(i int, indent string, last bool, depth int)
+	walk = func(i int, indent string, last bool, depth int) {
+		if seen[i] {
+			return
+		}
+		seen[i] = true
+		p := procs[i]
+		if depth > 0 {
+			p.forest = indent + " \\_ "
+			if last {
+				indent += "    "
+			} else {
+				indent += " |  "
+			}
+		}
+		out = append(out, p)
+		kids := children[p.pid]
+		for k, child := range kids {
+			walk(child, indent, k == len(kids)-1, depth+1)
+		}
+	}
+	for _, i := range roots {
+		walk(i, "", true, 0)
+	}
+	// Processes caught in a PPID cycle have no root; show them flat.
+	for i := range procs {
+		if !seen[i] {
+			walk(i, "", true, 0)
+		}
+	}
+	return out
+}
+
+// outputWidth returns the width lines are cut to: COLUMNS if set, else
+// the size of the terminal on stdout, else 0 for no limit.
+func outputWidth(stdio *core.Stdio) int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	if f, ok := stdio.Out.(*os.File); ok {
+		if w, _, err := term.GetSize(int(f.Fd())); err == nil && w > 0 {
+			return w
+		}
+	}
+	return 0
+}
+
+// fitWidth cuts line to width runes. COMMAND is always the last column,
+// so it is the one that gets truncated.
+func fitWidth(line string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	runes := []rune(line)
+	return string(runes[:width])
+}
+
 func listProcesses(includeThreads bool) []procInfo {
 	entries, err := os.ReadDir("/proc")
 	if err != nil {
@@ -114,9 +320,62 @@ func listProcesses(includeThreads bool) []procInfo {
 	sort.Slice(procs, func(i, j int) bool {
 		return procs[i].pid < procs[j].pid
 	})
+	computeUsage(procs)
 	return procs
 }
 
+// computeUsage fills in start times and the %CPU and %MEM figures, which
+// need the boot time, uptime and total memory of the system.
+func computeUsage(procs []procInfo) {
+	now := time.Now()
+	uptime := readUptime()
+	boot := now.Add(-uptime)
+	memKB := readMemTotal()
+	for i := range procs {
+		p := &procs[i]
+		if uptime == 0 || p.state == "" {
+			continue
+		}
+		p.started = boot.Add(p.startup)
+		if elapsed := uptime - p.startup; elapsed > 0 {
+			p.pcpu = 100 * p.cpuTime.Seconds() / elapsed.Seconds()
+		}
+		if memKB > 0 {
+			p.pmem = 100 * float64(p.rssKB) / float64(memKB)
+		}
+	}
+}
+
+func readUptime() time.Duration {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+func readMemTotal() int {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			return parseInt(fields[1])
+		}
+	}
+	return 0
+}
+
 func listThreads(pid int) []procInfo {
 	taskDir := filepath.Join("/proc", strconv.Itoa(pid), "task")
 	entries, err := os.ReadDir(taskDir)
@@ -141,11 +400,12 @@ func listThreads(pid int) []procInfo {
 func readProc(pid int, ownerPid int) procInfo {
 	info := procInfo{pid: pid}
 	status, uid, gid := readStatus(ownerPid)
+	info.uid = uid
 	info.user = procutil.LookupUser(uid)
 	info.group = lookupGroup(gid)
 	info.comm = readComm(pid)
 	info.args = readCmdline(pid)
-	info.ppid, info.pgid, info.sid, info.ttyNr, info.stat, info.nice, info.vszKB, info.rssKB = readStat(pid)
+	readStat(pid, &info)
 	info.ttyStr = formatTTY(info.ttyNr)
 	if status == "" {
 		info.user = "?"
@@ -224,35 +484,58 @@ func lookupGroup(gid string) string {
 	return gid
 }
 
-func readStat(pid int) (int, int, int, int, string, int, int, int) {
+// readStat fills info from /proc/PID/stat.
+func readStat(pid int, info *procInfo) {
 	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat")) // #nosec G304 -- /proc read
 	if err != nil {
-		return 0, 0, 0, 0, "", 0, 0, 0
+		return
 	}
 	stat := strings.TrimSpace(string(data))
 	closeIdx := strings.LastIndex(stat, ") ")
 	if closeIdx == -1 {
-		return 0, 0, 0, 0, "", 0, 0, 0
+		return
 	}
 	rest := strings.Fields(stat[closeIdx+2:])
 	if len(rest) < 22 {
-		return 0, 0, 0, 0, "", 0, 0, 0
+		return
+	}
+	info.state = rest[0]
+	info.ppid = parseInt(rest[1])
+	info.pgid = parseInt(rest[2])
+	info.sid = parseInt(rest[3])
+	info.ttyNr = parseInt(rest[4])
+	info.tpgid = parseInt(rest[5])
+	ticks := parseInt(rest[11]) + parseInt(rest[12])
+	info.cpuTime = time.Duration(ticks) * time.Second / clockTicks
+	info.priority = parseInt(rest[15])
+	info.nice = parseInt(rest[16])
+	info.threads = parseInt(rest[17])
+	info.startup = time.Duration(parseInt(rest[19])) * time.Second / clockTicks
+	info.vszKB = parseInt(rest[20]) / 1024
+	info.rssKB = parseInt(rest[21]) * os.Getpagesize() / 1024
+	info.stat = info.state
+	if info.nice < 0 {
+		info.stat += "<"
+	} else if info.nice > 0 {
+		info.stat += "N"
+	}
+}
+
+// bsdStat renders the STAT column of the u and -f formats: the state
+// followed by < or N for priority, s for a session leader, l for a
+// multi-threaded process and + for the foreground process group.
+func bsdStat(p procInfo) string {
+	stat := p.stat
+	if p.pid == p.sid {
+		stat += "s"
 	}
-	ppid := parseInt(rest[1])
-	pgid := parseInt(rest[2])
-	sid := parseInt(rest[3])
-	ttyNr := parseInt(rest[4])
-	state := rest[0]
-	nice := parseInt(rest[16])
-	vsizeKB := parseInt(rest[20]) / 1024
-	rssKB := parseInt(rest[21]) * int(os.Getpagesize()) / 1024
-	statField := state
-	if nice < 0 {
-		statField += "<"
-	} else if nice > 0 {
-		statField += "N"
+	if p.threads > 1 {
+		stat += "l"
 	}
-	return ppid, pgid, sid, ttyNr, statField, nice, vsizeKB, rssKB
+	if p.tpgid > 0 && p.tpgid == p.pgid {
+		stat += "+"
+	}
+	return stat
 }
 
 func parseInt(value string) int {
@@ -273,25 +556,87 @@ func formatTTY(ttyNr int) string {
 	return fmt.Sprintf("%d,%d", major, minor)
 }
 
-func printCustom(stdio *core.Stdio, procs []procInfo, columns string) int {
-	cols, invalid := parseColumns(columns)
-	if invalid != "" {
-		stdio.Errorf("ps: bad -o argument '%s', supported arguments: user,group,comm,args,pid,ppid,pgid,nice,rgroup,ruser,tty,vsz,sid,stat,rss\n", invalid)
-		return core.ExitFailure
+// ttyName names a controlling terminal the way procps does: pts/N,
+// ttyN or ttySN, or "?" when there is none.
+func ttyName(ttyNr int) string {
+	if ttyNr <= 0 {
+		return "?"
 	}
-	stdio.Println(formatHeader(cols))
-	for _, p := range procs {
-		stdio.Println(formatRow(cols, p))
+	dev := int64(ttyNr)
+	major := (dev >> 8) & 0xfff
+	minor := (dev & 0xff) | ((dev >> 12) & 0xfff00)
+	switch {
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("ttyS%d", minor-64)
+	}
+	return formatTTY(ttyNr)
+}
+
+// formatStart renders START/STIME: the time of day for processes started
+// in the last day, the month and day within the year, else the year.
+func formatStart(started, now time.Time) string {
+	switch {
+	case started.IsZero():
+		return "?"
+	case now.Sub(started) < 24*time.Hour:
+		return started.Format("15:04")
+	case started.Year() == now.Year():
+		return started.Format("Jan02")
 	}
-	return core.ExitSuccess
+	return started.Format("2006")
+}
+
+// formatElapsed renders elapsed time as [[DD-]HH:]MM:SS.
+func formatElapsed(d time.Duration) string {
+	secs := int(d / time.Second)
+	days, hours := secs/86400, secs/3600%24
+	out := fmt.Sprintf("%02d:%02d", secs/60%60, secs%60)
+	if days > 0 {
+		return fmt.Sprintf("%d-%02d:%s", days, hours, out)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%02d:%s", hours, out)
+	}
+	return out
+}
+
+// formatCPUTime renders cumulative CPU time as MMM:SS, or as
+// [DD-]HH:MM:SS when long is set.
+func formatCPUTime(d time.Duration, long bool) string {
+	secs := int(d / time.Second)
+	if !long {
+		return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+	}
+	days := secs / 86400
+	secs %= 86400
+	out := fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	if days > 0 {
+		out = fmt.Sprintf("%d-%s", days, out)
+	}
+	return out
+}
+
+// fullCommand is COMMAND for the u and -f formats; processes without a
+// command line, such as kernel threads, show their name in brackets.
+func fullCommand(p procInfo) string {
+	if p.args == "" {
+		return "[" + p.comm + "]"
+	}
+	return p.args
 }
 
 type columnSpec struct {
-	name   string
-	header string
-	value  func(procInfo) string
-	width  int
-	left   bool
+	name        string
+	header      string
+	value       func(procInfo) string
+	num         func(procInfo) float64 // sort key for numeric fields
+	width       int
+	left        bool
+	rightHeader bool
 }
 
 func parseColumns(spec string) ([]columnSpec, string) {
@@ -324,7 +669,7 @@ func parseColumns(spec string) ([]columnSpec, string) {
 func columnByName(name string) (columnSpec, bool) {
 	switch name {
 	case "pid":
-		return columnSpec{name: name, header: "PID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.pid) }}, true
+		return columnSpec{name: name, header: "PID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.pid) }, num: func(p procInfo) float64 { return float64(p.pid) }}, true
 	case "user":
 		return columnSpec{name: name, header: "USER", width: 8, left: true, value: func(p procInfo) string { return p.user }}, true
 	case "ruser":
@@ -343,26 +688,101 @@ func columnByName(name string) (columnSpec, bool) {
 	case "args":
 		return columnSpec{name: name, header: "COMMAND", value: commandDisplay}, true
 	case "ppid":
-		return columnSpec{name: name, header: "PPID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.ppid) }}, true
+		return columnSpec{name: name, header: "PPID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.ppid) }, num: func(p procInfo) float64 { return float64(p.ppid) }}, true
 	case "pgid":
-		return columnSpec{name: name, header: "PGID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.pgid) }}, true
+		return columnSpec{name: name, header: "PGID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.pgid) }, num: func(p procInfo) float64 { return float64(p.pgid) }}, true
 	case "sid":
-		return columnSpec{name: name, header: "SID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.sid) }}, true
+		return columnSpec{name: name, header: "SID", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.sid) }, num: func(p procInfo) float64 { return float64(p.sid) }}, true
 	case "tty":
 		return columnSpec{name: name, header: "TT", width: 6, left: true, value: func(p procInfo) string { return p.ttyStr }}, true
 	case "vsz":
-		return columnSpec{name: name, header: "VSZ", width: 4, left: false, value: func(p procInfo) string { return formatSize(p.vszKB) }}, true
+		return columnSpec{name: name, header: "VSZ", width: 4, left: false, value: func(p procInfo) string { return formatSize(p.vszKB) }, num: func(p procInfo) float64 { return float64(p.vszKB) }}, true
 	case "rss":
-		return columnSpec{name: name, header: "RSS", width: 4, left: false, value: func(p procInfo) string { return formatSize(p.rssKB) }}, true
+		return columnSpec{name: name, header: "RSS", width: 4, left: false, value: func(p procInfo) string { return formatSize(p.rssKB) }, num: func(p procInfo) float64 { return float64(p.rssKB) }}, true
 	case "nice":
-		return columnSpec{name: name, header: "NI", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.nice) }}, true
+		return columnSpec{name: name, header: "NI", width: 5, left: false, value: func(p procInfo) string { return strconv.Itoa(p.nice) }, num: func(p procInfo) float64 { return float64(p.nice) }}, true
+	case "pri":
+		return columnSpec{name: name, header: "PRI", width: 3, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(39 - p.priority) }, num: func(p procInfo) float64 { return float64(39 - p.priority) }}, true
 	case "stat":
 		return columnSpec{name: name, header: "STAT", width: 4, left: true, value: func(p procInfo) string { return p.stat }}, true
+	case "uid":
+		return columnSpec{name: name, header: "UID", width: 5, rightHeader: true, value: func(p procInfo) string { return p.uid }, num: func(p procInfo) float64 { return float64(parseInt(p.uid)) }}, true
+	case "%cpu", "pcpu":
+		return columnSpec{name: name, header: "%CPU", width: 4, rightHeader: true, value: func(p procInfo) string { return fmt.Sprintf("%.1f", p.pcpu) }, num: func(p procInfo) float64 { return p.pcpu }}, true
+	case "%mem", "pmem":
+		return columnSpec{name: name, header: "%MEM", width: 4, rightHeader: true, value: func(p procInfo) string { return fmt.Sprintf("%.1f", p.pmem) }, num: func(p procInfo) float64 { return p.pmem }}, true
+	case "time":
+		return columnSpec{name: name, header: "TIME", width: 8, rightHeader: true, value: func(p procInfo) string { return formatCPUTime(p.cpuTime, true) }, num: func(p procInfo) float64 { return p.cpuTime.Seconds() }}, true
+	case "etime":
+		return columnSpec{name: name, header: "ELAPSED", width: 11, rightHeader: true, value: func(p procInfo) string {
+			if p.started.IsZero() {
+				return "-"
+			}
+			return formatElapsed(time.Since(p.started))
+		}, num: func(p procInfo) float64 { return -float64(p.started.UnixNano()) }}, true
 	default:
 		return columnSpec{}, false
 	}
 }
 
+// supportedColumns lists the -o field names for error messages.
+const supportedColumns = "user,group,comm,args,pid,ppid,pgid,nice,pri,rgroup,ruser,tty,vsz,sid,stat,rss,uid,pcpu,pmem,time,etime"
+
+// sortKey is one field of a --sort specification.
+type sortKey struct {
+	col  columnSpec
+	desc bool
+}
+
+// parseSort parses a --sort list of [+-]FIELD entries. It returns the
+// offending field name when one is unknown.
+func parseSort(spec string) ([]sortKey, string) {
+	var keys []sortKey
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		desc := false
+		if strings.HasPrefix(field, "-") {
+			desc = true
+			field = field[1:]
+		} else {
+			field = strings.TrimPrefix(field, "+")
+		}
+		col, ok := columnByName(strings.ToLower(field))
+		if field == "" || !ok {
+			return nil, field
+		}
+		keys = append(keys, sortKey{col: col, desc: desc})
+	}
+	return keys, ""
+}
+
+// sortProcs orders procs by keys. Numeric fields compare as numbers and
+// the others lexically; ties keep PID order.
+func sortProcs(procs []procInfo, keys []sortKey) {
+	sort.SliceStable(procs, func(i, j int) bool {
+		for _, key := range keys {
+			c := 0
+			if key.col.num != nil {
+				a, b := key.col.num(procs[i]), key.col.num(procs[j])
+				if a < b {
+					c = -1
+				} else if a > b {
+					c = 1
+				}
+			} else {
+				c = strings.Compare(key.col.value(procs[i]), key.col.value(procs[j]))
+			}
+			if key.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
 func defaultColumns() []columnSpec {
 	return []columnSpec{
 		{
@@ -391,6 +811,39 @@ func defaultColumns() []columnSpec {
 	}
 }
 
+// userColumns is the BSD "u" format used by "ps aux".
+func userColumns() []columnSpec {
+	now := time.Now()
+	return []columnSpec{
+		{name: "user", header: "USER", width: 8, left: true, value: func(p procInfo) string { return p.user }},
+		{name: "pid", header: "PID", width: 7, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(p.pid) }},
+		{name: "%cpu", header: "%CPU", width: 4, rightHeader: true, value: func(p procInfo) string { return fmt.Sprintf("%.1f", p.pcpu) }},
+		{name: "%mem", header: "%MEM", width: 4, rightHeader: true, value: func(p procInfo) string { return fmt.Sprintf("%.1f", p.pmem) }},
+		{name: "vsz", header: "VSZ", width: 6, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(p.vszKB) }},
+		{name: "rss", header: "RSS", width: 5, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(p.rssKB) }},
+		{name: "tty", header: "TTY", width: 8, left: true, value: func(p procInfo) string { return ttyName(p.ttyNr) }},
+		{name: "stat", header: "STAT", width: 4, left: true, value: bsdStat},
+		{name: "start", header: "START", width: 5, rightHeader: true, value: func(p procInfo) string { return formatStart(p.started, now) }},
+		{name: "time", header: "TIME", width: 6, rightHeader: true, value: func(p procInfo) string { return formatCPUTime(p.cpuTime, false) }},
+		{name: "args", header: "COMMAND", value: fullCommand},
+	}
+}
+
+// fullColumns is the SysV "-f" format used by "ps -ef".
+func fullColumns() []columnSpec {
+	now := time.Now()
+	return []columnSpec{
+		{name: "uid", header: "UID", width: 8, left: true, value: func(p procInfo) string { return p.user }},
+		{name: "pid", header: "PID", width: 7, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(p.pid) }},
+		{name: "ppid", header: "PPID", width: 7, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(p.ppid) }},
+		{name: "c", header: "C", width: 2, rightHeader: true, value: func(p procInfo) string { return strconv.Itoa(int(p.pcpu)) }},
+		{name: "stime", header: "STIME", width: 5, left: true, value: func(p procInfo) string { return formatStart(p.started, now) }},
+		{name: "tty", header: "TTY", width: 8, left: true, value: func(p procInfo) string { return ttyName(p.ttyNr) }},
+		{name: "time", header: "TIME", width: 8, rightHeader: true, value: func(p procInfo) string { return formatCPUTime(p.cpuTime, true) }},
+		{name: "args", header: "CMD", value: fullCommand},
+	}
+}
+
 func formatHeader(cols []columnSpec) string {
 	headers := make([]string, len(cols))
 	for i, col := range cols {
@@ -403,6 +856,9 @@ func formatRow(cols []columnSpec, p procInfo) string {
 	values := make([]string, len(cols))
 	for i, col := range cols {
 		values[i] = col.value(p)
+		if col.name == "args" || col.name == "comm" {
+			values[i] = p.forest + values[i]
+		}
 	}
 	return formatRowValues(cols, values, false)
 }
@@ -412,7 +868,7 @@ func formatRowValues(cols []columnSpec, values []string, header bool) string {
 	for i, col := range cols {
 		value := values[i]
 		if col.width > 0 {
-			left := header || col.left
+			left := col.left || (header && !col.rightHeader)
 			if left {
 				value = fmt.Sprintf("%-*s", col.width, value)
 			} else {
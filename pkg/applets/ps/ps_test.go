@@ -1,6 +1,9 @@
 package ps_test
 
 import (
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/ps"
@@ -28,6 +31,48 @@ func TestPs(t *testing.T) {
 			WantCode: core.ExitUsage,
 			WantErr:  "invalid option",
 		},
+		{
+			Name:       "aux",
+			Args:       []string{"aux"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "USER         PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND\n",
+		},
+		{
+			Name:       "full",
+			Args:       []string{"-ef"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "UID          PID    PPID  C STIME TTY          TIME CMD\n",
+		},
+		{
+			Name:     "bad_bsd_option",
+			Args:     []string{"auq"},
+			WantCode: core.ExitUsage,
+			WantErr:  "unsupported option 'q'",
+		},
+		{
+			Name:       "custom_header",
+			Args:       []string{"-o", "pid=MYPID,pri,etime"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "MYPID PRI     ELAPSED\n",
+		},
+		{
+			Name:     "unknown_field",
+			Args:     []string{"-o", "pid,bogus"},
+			WantCode: core.ExitFailure,
+			WantErr:  "bad -o argument 'bogus'",
+		},
+		{
+			Name:     "unknown_sort_key",
+			Args:     []string{"--sort=-bogus"},
+			WantCode: core.ExitFailure,
+			WantErr:  "unknown sort key 'bogus'",
+		},
+		{
+			Name:     "sort_missing_argument",
+			Args:     []string{"--sort"},
+			WantCode: core.ExitUsage,
+			WantErr:  "requires an argument",
+		},
 		{
 			Name:       "ignored_option",
 			Args:       []string{"-Z"},
@@ -38,3 +83,159 @@ func TestPs(t *testing.T) {
 
 	testutil.RunAppletTests(t, ps.Run, tests)
 }
+
+// selfRow returns the line of out describing this test process.
+func selfRow(t *testing.T, out string, pidField int) []string {
+	t.Helper()
+	pid := strconv.Itoa(os.Getpid())
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > pidField && fields[pidField] == pid {
+			return fields
+		}
+	}
+	t.Fatalf("no row for pid %s in:\n%s", pid, out)
+	return nil
+}
+
+func TestPsFormats(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	t.Setenv("COLUMNS", "")
+
+	out, _, code := testutil.CaptureAndRun(t, ps.Run, []string{"aux"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	row := selfRow(t, out.String(), 1)
+	for i, name := range []string{"%CPU", "%MEM"} {
+		if _, err := strconv.ParseFloat(row[2+i], 64); err != nil {
+			t.Errorf("%s = %q, want a number", name, row[2+i])
+		}
+	}
+	// Go test binaries always run several threads.
+	if stat := row[7]; !strings.Contains(stat, "l") {
+		t.Errorf("STAT = %q, want the l flag", stat)
+	}
+	if !strings.Contains(row[9], ":") {
+		t.Errorf("TIME = %q, want M:SS", row[9])
+	}
+
+	out, _, code = testutil.CaptureAndRun(t, ps.Run, []string{"-ef"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	row = selfRow(t, out.String(), 1)
+	if row[2] != strconv.Itoa(os.Getppid()) {
+		t.Errorf("PPID = %q, want %d", row[2], os.Getppid())
+	}
+	if len(row[6]) != len("00:00:00") {
+		t.Errorf("TIME = %q, want HH:MM:SS", row[6])
+	}
+}
+
+func TestPsWidth(t *testing.T) {
+	t.Setenv("COLUMNS", "30")
+	out, _, code := testutil.CaptureAndRun(t, ps.Run, []string{"aux"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if len([]rune(line)) > 30 {
+			t.Fatalf("line longer than COLUMNS: %q", line)
+		}
+	}
+
+	out, _, code = testutil.CaptureAndRun(t, ps.Run, []string{"auxw"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	testutil.AssertOutputContains(t, out.String(), "%MEM    VSZ   RSS TTY      STAT START   TIME COMMAND\n")
+
+	out, _, code = testutil.CaptureAndRun(t, ps.Run, []string{"-ef", "-w"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	testutil.AssertOutputContains(t, out.String(), "TIME CMD\n")
+}
+
+// column returns field idx of every row after the header.
+func column(out string, idx int) []string {
+	var vals []string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) > idx {
+			vals = append(vals, fields[idx])
+		}
+	}
+	return vals
+}
+
+func TestPsSelectAndSort(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	t.Setenv("COLUMNS", "")
+
+	out, _, code := testutil.CaptureAndRun(t, ps.Run, []string{"-o", "pid,ppid,comm"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	if header := strings.Fields(strings.SplitN(out.String(), "\n", 2)[0]); strings.Join(header, " ") != "PID PPID COMMAND" {
+		t.Fatalf("header = %v, -o must replace the default columns", header)
+	}
+
+	out, _, code = testutil.CaptureAndRun(t, ps.Run, []string{"-o", "pid", "--sort=-pid"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	pids := column(out.String(), 0)
+	for i := 1; i < len(pids); i++ {
+		// Numeric, not lexical: "10" sorts above "9" here.
+		if parseNum(t, pids[i-1]) < parseNum(t, pids[i]) {
+			t.Fatalf("--sort=-pid not descending at %s, %s", pids[i-1], pids[i])
+		}
+	}
+
+	out, _, code = testutil.CaptureAndRun(t, ps.Run, []string{"-o", "user,pid", "--sort", "user,+pid"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	users := column(out.String(), 0)
+	pids = column(out.String(), 1)
+	for i := 1; i < len(users); i++ {
+		if users[i-1] > users[i] || users[i-1] == users[i] && parseNum(t, pids[i-1]) > parseNum(t, pids[i]) {
+			t.Fatalf("--sort=user,+pid out of order at row %d: %v %v", i, users[i-1:i+1], pids[i-1:i+1])
+		}
+	}
+}
+
+func parseNum(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatalf("not a number: %q", s)
+	}
+	return n
+}
+
+func TestPsForest(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	t.Setenv("COLUMNS", "")
+
+	for _, args := range [][]string{{"-o", "pid,ppid,args", "--forest"}, {"axf", "-o", "pid,ppid,args"}} {
+		out, _, code := testutil.CaptureAndRun(t, ps.Run, args, "")
+		testutil.AssertExitCode(t, code, core.ExitSuccess)
+		indent := map[string]int{}
+		order := map[string]int{}
+		for n, line := range strings.Split(out.String(), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			cmd := line[strings.Index(line, fields[1])+len(fields[1]):]
+			indent[fields[0]] = len(cmd) - len(strings.TrimLeft(cmd, " |\\_"))
+			order[fields[0]] = n
+		}
+		self, parent := strconv.Itoa(os.Getpid()), strconv.Itoa(os.Getppid())
+		if _, ok := indent[parent]; !ok {
+			t.Skipf("parent %s not visible", parent)
+		}
+		if indent[self] != indent[parent]+4 {
+			t.Errorf("%v: indent of %s is %d, parent's is %d\n%s", args, self, indent[self], indent[parent], out)
+		}
+		if order[self] <= order[parent] {
+			t.Errorf("%v: process listed before its parent", args)
+		}
+		if !strings.Contains(out.String(), "\\_ ") {
+			t.Errorf("%v: no tree connectors in output", args)
+		}
+	}
+}
@@ -2,6 +2,12 @@
 package sleep
 
 import (
+	"context"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/core/timeutil"
@@ -12,8 +18,11 @@ import (
 // Run executes the sleep command with the given arguments.
 //
 // Each argument specifies a duration to pause. Multiple arguments are summed.
-// Durations support optional suffixes: s (seconds, default), m (minutes),
-// h (hours), d (days).
+// Durations may be fractional and support optional suffixes: s (seconds,
+// default), m (minutes), h (hours), d (days), so "sleep 1m 30s" pauses for
+// 90 seconds. "inf" sleeps until interrupted.
+//
+// SIGINT and SIGTERM end the pause early with exit status 128+signal.
 func Run(stdio *core.Stdio, args []string) int {
 	if len(args) == 0 {
 		stdio.Println("BusyBox v1.35.0 (Debian 1:1.35.0-4+b7) multi-call binary.")
@@ -31,19 +40,54 @@ func Run(stdio *core.Stdio, args []string) int {
 		}
 		dur, err := parseDuration(arg)
 		if err != nil {
-			stdio.Errorf("sleep: invalid number '%s'\n", arg)
-			return core.ExitFailure
+			return core.UsageError(stdio, "sleep", "invalid number '"+arg+"'")
+		}
+		if total > math.MaxInt64-dur {
+			total = math.MaxInt64
+		} else {
+			total += dur
 		}
-		total += dur
 	}
-	time.Sleep(total)
-	return core.ExitSuccess
+	return pause(total)
 }
 
+// pause waits for d or until SIGINT or SIGTERM arrives.
+func pause(d time.Duration) int {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		return core.ExitSuccess
+	case sig := <-sigs:
+		if s, ok := sig.(syscall.Signal); ok {
+			return 128 + int(s)
+		}
+		return core.ExitFailure
+	}
+}
+
+// parseDuration accepts the durations GNU sleep does. Negative and NaN
+// values are rejected; infinity and overlong values saturate.
 func parseDuration(value string) (time.Duration, error) {
 	spec, err := timeutil.ParseDuration(value)
 	if err != nil {
 		return 0, err
 	}
+	if math.IsNaN(spec.Value) || spec.Value < 0 {
+		return 0, strconv.ErrRange
+	}
+	if spec.Value*float64(units[spec.Unit]) >= math.MaxInt64 {
+		return math.MaxInt64, nil
+	}
 	return spec.Duration, nil
 }
+
+var units = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
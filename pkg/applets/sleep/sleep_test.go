@@ -1,7 +1,10 @@
 package sleep_test
 
 import (
+	"os"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/sleep"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -19,8 +22,20 @@ func TestSleep(t *testing.T) {
 		{
 			Name:     "invalid",
 			Args:     []string{"1x"},
-			WantCode: core.ExitFailure,
-			WantErr:  "invalid number",
+			WantCode: core.ExitUsage,
+			WantErr:  "sleep: invalid number '1x'",
+		},
+		{
+			Name:     "negative",
+			Args:     []string{"-1"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid number '-1'",
+		},
+		{
+			Name:     "invalid_among_valid",
+			Args:     []string{"0.01", "2q"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid number '2q'",
 		},
 		{
 			Name:     "short",
@@ -30,3 +45,38 @@ func TestSleep(t *testing.T) {
 	}
 	testutil.RunAppletTests(t, sleep.Run, tests)
 }
+
+func TestSleepSums(t *testing.T) {
+	start := time.Now()
+	_, _, code := testutil.CaptureAndRun(t, sleep.Run, []string{"0.1", "0.002m", "0.05s"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	// 0.1s + 0.12s + 0.05s
+	if elapsed := time.Since(start); elapsed < 270*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("slept %v, want about 270ms", elapsed)
+	}
+}
+
+func TestSleepInterrupt(t *testing.T) {
+	for _, sig := range []syscall.Signal{syscall.SIGINT, syscall.SIGTERM} {
+		done := make(chan int, 1)
+		start := time.Now()
+		go func() {
+			_, _, code := testutil.CaptureAndRun(t, sleep.Run, []string{"1m", "30s"}, "")
+			done <- code
+		}()
+		// Give Run time to install its handler before signalling.
+		time.Sleep(200 * time.Millisecond)
+		if err := syscall.Kill(os.Getpid(), sig); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case code := <-done:
+			testutil.AssertExitCode(t, code, 128+int(sig))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("sleep ignored %v", sig)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%v took %v to end the sleep", sig, elapsed)
+		}
+	}
+}
@@ -16,118 +16,243 @@ import (
 )
 
 type options struct {
-	showTCP    bool
-	showUDP    bool
-	showListen bool
-	numeric    bool
-	showUsers  bool
-	summary    bool
+	showTCP   bool
+	showUDP   bool
+	showAll   bool
+	listening bool
+	numeric   bool
+	showUsers bool
+	summary   bool
+	ipv4      bool
+	ipv6      bool
+	states    uint32
 }
 
 type socketEntry struct {
-	netid string
-	state string
-	recvQ int
-	sendQ int
-	local string
-	peer  string
-	inode string
-	user  string
+	netid  string
+	family int
+	code   int
+	state  string
+	recvQ  int
+	sendQ  int
+	local  string
+	peer   string
+	inode  string
 }
 
-type summaryCounts struct {
-	total int
-	tcp   int
-	udp   int
+// Kernel TCP state codes as they appear in the st column of /proc/net/*.
+const (
+	stateEstablished = 0x01
+	stateSynSent     = 0x02
+	stateSynRecv     = 0x03
+	stateFinWait1    = 0x04
+	stateFinWait2    = 0x05
+	stateTimeWait    = 0x06
+	stateClose       = 0x07
+	stateCloseWait   = 0x08
+	stateLastAck     = 0x09
+	stateListen      = 0x0A
+	stateClosing     = 0x0B
+)
+
+const (
+	maskAll       = uint32(1<<(stateClosing+1)) - 2
+	maskConnected = maskAll &^ (1<<stateListen | 1<<stateClose)
+	maskBucket    = 1<<stateSynRecv | 1<<stateTimeWait
+	// maskDefault is what ss shows without -a, -l or a state filter.
+	maskDefault = maskConnected &^ maskBucket
+)
+
+var stateFilters = map[string]uint32{
+	"established":  1 << stateEstablished,
+	"syn-sent":     1 << stateSynSent,
+	"syn-recv":     1 << stateSynRecv,
+	"fin-wait-1":   1 << stateFinWait1,
+	"fin-wait-2":   1 << stateFinWait2,
+	"time-wait":    1 << stateTimeWait,
+	"closed":       1 << stateClose,
+	"close-wait":   1 << stateCloseWait,
+	"last-ack":     1 << stateLastAck,
+	"listening":    1 << stateListen,
+	"closing":      1 << stateClosing,
+	"all":          maskAll,
+	"connected":    maskConnected,
+	"synchronized": maskConnected &^ (1 << stateSynSent),
+	"bucket":       maskBucket,
+	"big":          maskAll &^ maskBucket,
+}
+
+var stateLabels = map[int]string{
+	stateEstablished: "ESTAB",
+	stateSynSent:     "SYN-SENT",
+	stateSynRecv:     "SYN-RECV",
+	stateFinWait1:    "FIN-WAIT-1",
+	stateFinWait2:    "FIN-WAIT-2",
+	stateTimeWait:    "TIME-WAIT",
+	stateClose:       "UNCONN",
+	stateCloseWait:   "CLOSE-WAIT",
+	stateLastAck:     "LAST-ACK",
+	stateListen:      "LISTEN",
+	stateClosing:     "CLOSING",
+}
+
+// procNetFiles lists the socket tables ss reads, in output order.
+var procNetFiles = []struct {
+	path   string
+	netid  string
+	family int
+}{
+	{"/proc/net/tcp", "tcp", 4},
+	{"/proc/net/tcp6", "tcp", 6},
+	{"/proc/net/udp", "udp", 4},
+	{"/proc/net/udp6", "udp", 6},
 }
 
 // Run executes the ss command with the given arguments.
 //
+// Usage:
+//
+//	ss [-tulanp46s] [state STATE]...
+//
 // Supported flags:
 //
 //	-t    Display TCP sockets
 //	-u    Display UDP sockets
 //	-l    Display listening sockets only
+//	-a    Display listening and non-listening sockets
 //	-n    Show numeric addresses (do not resolve names)
-//	-p    Show process using socket (not implemented, accepted)
+//	-p    Show the process using each socket
+//	-4    Display IPv4 sockets only
+//	-6    Display IPv6 sockets only
 //	-s    Print summary statistics
 //
+// Without -t or -u both protocols are listed. Without -a, -l or a state
+// filter only connected sockets are shown, as ss does. STATE is a kernel
+// state name (established, syn-sent, syn-recv, fin-wait-1, fin-wait-2,
+// time-wait, closed, close-wait, last-ack, listening, closing) or one of
+// the groups all, connected, synchronized, bucket and big; several state
+// filters are combined. UDP sockets are connectionless, so for them
+// "listening" means an unconnected socket.
+//
 // Reads socket information from /proc/net/tcp, /proc/net/tcp6,
-// /proc/net/udp, and /proc/net/udp6.
+// /proc/net/udp, and /proc/net/udp6; -p matches socket inodes against the
+// links in /proc/*/fd.
 func Run(stdio *core.Stdio, args []string) int {
 	opts := options{}
-	for _, arg := range args {
-		if arg == "-s" {
-			opts.summary = true
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "state" {
+			if i+1 >= len(args) {
+				return core.UsageError(stdio, "ss", "missing state")
+			}
+			i++
+			mask, ok := stateFilters[strings.ToLower(args[i])]
+			if !ok {
+				return core.UsageError(stdio, "ss", "wrong state name: "+args[i])
+			}
+			opts.states |= mask
 			continue
 		}
-		if strings.HasPrefix(arg, "-") && arg != "-" {
-			for _, c := range arg[1:] {
-				switch c {
-				case 't':
-					opts.showTCP = true
-				case 'u':
-					opts.showUDP = true
-				case 'l':
-					opts.showListen = true
-				case 'n':
-					opts.numeric = true
-				case 'p':
-					opts.showUsers = true
-				case 's':
-					opts.summary = true
-				default:
-					return core.UsageError(stdio, "ss", "invalid option -- '"+string(c)+"'")
-				}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return core.UsageError(stdio, "ss", "unknown filter: "+arg)
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 't':
+				opts.showTCP = true
+			case 'u':
+				opts.showUDP = true
+			case 'l':
+				opts.listening = true
+			case 'a':
+				opts.showAll = true
+			case 'n':
+				opts.numeric = true
+			case 'p':
+				opts.showUsers = true
+			case 's':
+				opts.summary = true
+			case '4':
+				opts.ipv4 = true
+			case '6':
+				opts.ipv6 = true
+			default:
+				return core.UsageError(stdio, "ss", "invalid option -- '"+string(c)+"'")
 			}
 		}
 	}
+	if opts.ipv4 && opts.ipv6 {
+		opts.ipv4, opts.ipv6 = false, false
+	}
 	if !opts.showTCP && !opts.showUDP {
 		opts.showTCP = true
 		opts.showUDP = true
 	}
-
-	userMap := map[string]string{}
-	if opts.showUsers {
-		userMap = buildUserMap()
+	if opts.states == 0 {
+		switch {
+		case opts.showAll:
+			opts.states = maskAll
+		case opts.listening:
+			opts.states = 1 << stateListen
+		default:
+			opts.states = maskDefault
+		}
 	}
 
-	entries, counts := collectEntries(opts, userMap)
+	entries := readSockets()
 	if opts.summary {
-		printSummary(stdio, counts)
+		printSummary(stdio, entries)
 		return core.ExitSuccess
 	}
 
-	stdio.Println("Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess")
-	for _, e := range entries {
-		user := ""
-		if e.user != "" {
-			user = e.user
-		}
-		stdio.Printf("%-5s %-6s %6d %6d %-20s %-20s%s\n", e.netid, e.state, e.recvQ, e.sendQ, e.local, e.peer, user)
+	userMap := map[string]string{}
+	if opts.showUsers {
+		userMap = buildUserMap()
+	}
+
+	stdio.Printf("%-5s %-10s %6s %6s %-24s %-24s %s\n", "Netid", "State", "Recv-Q", "Send-Q", "Local Address:Port", "Peer Address:Port", "Process")
+	for _, e := range filterEntries(entries, opts) {
+		local := formatAddr(e.local, e.netid, opts.numeric)
+		peer := formatAddr(e.peer, e.netid, opts.numeric)
+		line := fmt.Sprintf("%-5s %-10s %6d %6d %-24s %-24s %s", e.netid, e.state, e.recvQ, e.sendQ, local, peer, userMap[e.inode])
+		stdio.Println(strings.TrimRight(line, " "))
 	}
 	return core.ExitSuccess
 }
 
-func collectEntries(opts options, userMap map[string]string) ([]socketEntry, summaryCounts) {
-	entries := []socketEntry{}
-	counts := summaryCounts{}
-	if opts.showTCP {
-		es := readProcNet("/proc/net/tcp", "tcp", opts, userMap)
-		entries = append(entries, es...)
-		counts.tcp += len(es)
-		counts.total += len(es)
+// readSockets returns every socket listed in the /proc/net tables. Local
+// and peer addresses are left in their raw hex form.
+func readSockets() []socketEntry {
+	var entries []socketEntry
+	for _, f := range procNetFiles {
+		entries = append(entries, readProcNet(f.path, f.netid, f.family)...)
 	}
-	if opts.showUDP {
-		es := readProcNet("/proc/net/udp", "udp", opts, userMap)
-		entries = append(entries, es...)
-		counts.udp += len(es)
-		counts.total += len(es)
+	return entries
+}
+
+func filterEntries(entries []socketEntry, opts options) []socketEntry {
+	var out []socketEntry
+	for _, e := range entries {
+		if (e.netid == "tcp" && !opts.showTCP) || (e.netid == "udp" && !opts.showUDP) {
+			continue
+		}
+		if (opts.ipv4 && e.family != 4) || (opts.ipv6 && e.family != 6) {
+			continue
+		}
+		code := e.code
+		if e.netid == "udp" && code == stateClose {
+			// An unconnected UDP socket is the closest thing to a listener.
+			code = stateListen
+		}
+		if opts.states&(1<<code) == 0 {
+			continue
+		}
+		out = append(out, e)
 	}
-	return entries, counts
+	return out
 }
 
-func readProcNet(path string, netid string, opts options, userMap map[string]string) []socketEntry {
+func readProcNet(path string, netid string, family int) []socketEntry {
 	if !strings.HasPrefix(path, "/proc/") {
 		return nil
 	}
@@ -149,27 +274,25 @@ func readProcNet(path string, netid string, opts options, userMap map[string]str
 		if len(fields) < 10 {
 			continue
 		}
-		state := tcpState(fields[3])
-		if opts.showListen && state != "LISTEN" {
+		code, err := parseHex(fields[3])
+		if err != nil {
 			continue
 		}
-		sendQ, recvQ := parseQueue(fields[4])
-		local := formatAddr(fields[1], netid, opts.numeric)
-		peer := formatAddr(fields[2], netid, opts.numeric)
-		inode := fields[9]
-		user := ""
-		if name, ok := userMap[inode]; ok {
-			user = " " + name
+		state := stateLabels[code]
+		if state == "" {
+			state = "UNKNOWN"
 		}
+		sendQ, recvQ := parseQueue(fields[4])
 		entries = append(entries, socketEntry{
-			netid: netid,
-			state: state,
-			recvQ: recvQ,
-			sendQ: sendQ,
-			local: local,
-			peer:  peer,
-			inode: inode,
-			user:  user,
+			netid:  netid,
+			family: family,
+			code:   code,
+			state:  state,
+			recvQ:  recvQ,
+			sendQ:  sendQ,
+			local:  fields[1],
+			peer:   fields[2],
+			inode:  fields[9],
 		})
 	}
 	return entries
@@ -185,38 +308,58 @@ func parseQueue(val string) (sendQ int, recvQ int) {
 	return sendQ, recvQ
 }
 
+// formatAddr renders a raw ADDR:PORT column from /proc/net/*. IPv6
+// addresses are bracketed and a zero port is shown as "*".
 func formatAddr(val string, netid string, numeric bool) string {
 	parts := strings.Split(val, ":")
 	if len(parts) != 2 {
 		return val
 	}
 	addrHex := parts[0]
-	portHex := parts[1]
-	port, _ := parseHex(portHex)
-	ip := parseIPv4(addrHex)
-	if ip == "" {
-		ip = "0.0.0.0"
+	port, _ := parseHex(parts[1])
+	ip := parseAddr(addrHex)
+	if ip == nil {
+		return val
 	}
-	if !numeric {
-		if host := resolveHost(ip); host != "" {
-			ip = host
+	host := ip.String()
+	if !numeric && !ip.IsUnspecified() {
+		if name := resolveHost(host); name != "" {
+			host = name
 		}
+	} else if len(ip) == net.IPv6len && ip.To4() != nil {
+		host = "::ffff:" + host
+	}
+	if len(ip) == net.IPv6len {
+		host = "[" + host + "]"
+	}
+	if port == 0 {
+		return host + ":*"
+	}
+	if !numeric {
 		if svc := resolveService(port, netid); svc != "" {
-			return fmt.Sprintf("%s:%s", ip, svc)
+			return fmt.Sprintf("%s:%s", host, svc)
 		}
 	}
-	return fmt.Sprintf("%s:%d", ip, port)
+	return fmt.Sprintf("%s:%d", host, port)
 }
 
-func parseIPv4(hexAddr string) string {
-	if len(hexAddr) != 8 {
-		return ""
+// parseAddr decodes an address from /proc/net/*, which stores it as
+// 32-bit words in host (little-endian) byte order.
+func parseAddr(hexAddr string) net.IP {
+	if len(hexAddr) != 8 && len(hexAddr) != 32 {
+		return nil
+	}
+	ip := make(net.IP, len(hexAddr)/2)
+	for word := 0; word < len(ip); word += 4 {
+		for i := 0; i < 4; i++ {
+			b, err := strconv.ParseUint(hexAddr[2*(word+i):2*(word+i)+2], 16, 8)
+			if err != nil {
+				return nil
+			}
+			ip[word+3-i] = byte(b)
+		}
 	}
-	b1, _ := parseHex(hexAddr[6:8])
-	b2, _ := parseHex(hexAddr[4:6])
-	b3, _ := parseHex(hexAddr[2:4])
-	b4, _ := parseHex(hexAddr[0:2])
-	return fmt.Sprintf("%d.%d.%d.%d", b1, b2, b3, b4)
+	return ip
 }
 
 func parseHex(val string) (int, error) {
@@ -236,24 +379,13 @@ func resolveService(port int, netid string) string {
 	return ""
 }
 
-func tcpState(code string) string {
-	switch code {
-	case "01":
-		return "ESTAB"
-	case "0A":
-		return "LISTEN"
-	case "07":
-		return "UNCONN"
-	default:
-		return "UNCONN"
-	}
-}
-
+// buildUserMap maps socket inodes to the users:(...) annotation listing
+// every process holding the socket open. It is built once per run.
 func buildUserMap() map[string]string {
-	users := map[string]string{}
+	owners := map[string][]string{}
 	entries, err := os.ReadDir("/proc")
 	if err != nil {
-		return users
+		return map[string]string{}
 	}
 	for _, entry := range entries {
 		if !entry.IsDir() {
@@ -268,24 +400,55 @@ func buildUserMap() map[string]string {
 		if err != nil {
 			continue
 		}
+		comm := ""
 		for _, fd := range fds {
 			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
-			if err != nil {
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
 				continue
 			}
-			if strings.HasPrefix(link, "socket:[") {
-				inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
-				if _, ok := users[inode]; !ok {
-					users[inode] = fmt.Sprintf("users:(\"%s\",pid=%s,fd=%s)", pid, pid, fd.Name())
-				}
+			if comm == "" {
+				data, _ := os.ReadFile(filepath.Join("/proc", pid, "comm")) // #nosec G304 -- reads /proc
+				comm = strings.TrimSpace(string(data))
 			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			owners[inode] = append(owners[inode], fmt.Sprintf("(%q,pid=%s,fd=%s)", comm, pid, fd.Name()))
 		}
 	}
+	users := make(map[string]string, len(owners))
+	for inode, list := range owners {
+		users[inode] = "users:(" + strings.Join(list, ",") + ")"
+	}
 	return users
 }
 
-func printSummary(stdio *core.Stdio, counts summaryCounts) {
-	stdio.Printf("Total: %d\n", counts.total)
-	stdio.Printf("TCP:   %d\n", counts.tcp)
-	stdio.Printf("UDP:   %d\n", counts.udp)
+// printSummary prints per-state TCP counts and a per-family transport
+// table, ignoring any filters.
+func printSummary(stdio *core.Stdio, entries []socketEntry) {
+	var tcpStates [stateClosing + 1]int
+	var tcp4, tcp6, udp4, udp6 int
+	for _, e := range entries {
+		switch {
+		case e.netid == "tcp" && e.family == 4:
+			tcp4++
+		case e.netid == "tcp":
+			tcp6++
+		case e.family == 4:
+			udp4++
+		default:
+			udp6++
+		}
+		if e.netid == "tcp" && e.code > 0 && e.code < len(tcpStates) {
+			tcpStates[e.code]++
+		}
+	}
+	synrecv := tcpStates[stateSynRecv]
+	closed := tcpStates[stateClose]
+	timewait := tcpStates[stateTimeWait]
+	stdio.Printf("Total: %d\n", len(entries))
+	stdio.Printf("TCP:   %d (estab %d, closed %d, timewait %d, synrecv %d, listen %d)\n",
+		tcp4+tcp6, tcpStates[stateEstablished], closed, timewait, synrecv, tcpStates[stateListen])
+	stdio.Println()
+	stdio.Printf("%-9s %-9s %-9s %-9s\n", "Transport", "Total", "IP", "IPv6")
+	stdio.Printf("%-9s %-9d %-9d %-9d\n", "UDP", udp4+udp6, udp4, udp6)
+	stdio.Printf("%-9s %-9d %-9d %-9d\n", "TCP", tcp4+tcp6, tcp4, tcp6)
 }
@@ -1,6 +1,10 @@
 package ss_test
 
 import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/ss"
@@ -16,7 +20,114 @@ func TestSs(t *testing.T) {
 			WantCode:   core.ExitSuccess,
 			WantOutSub: "Netid",
 		},
+		{
+			Name:       "summary",
+			Args:       []string{"-s"},
+			WantCode:   core.ExitSuccess,
+			WantOutSub: "Transport Total     IP        IPv6",
+		},
+		{
+			Name:     "bad_state",
+			Args:     []string{"state", "bogus"},
+			WantCode: core.ExitUsage,
+			WantErr:  "wrong state name",
+		},
+		{
+			Name:     "missing_state",
+			Args:     []string{"state"},
+			WantCode: core.ExitUsage,
+			WantErr:  "missing state",
+		},
 	}
 
 	testutil.RunAppletTests(t, ss.Run, tests)
 }
+
+func TestSsLiveSockets(t *testing.T) {
+	if _, err := os.Stat("/proc/net/tcp"); err != nil {
+		t.Skip("no /proc/net/tcp")
+	}
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	udp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer udp.Close()
+
+	listenAddr := ln.Addr().String()
+	clientAddr := conn.LocalAddr().String()
+	udpAddr := udp.LocalAddr().String()
+	run := func(args ...string) string {
+		t.Helper()
+		out, _, code := testutil.CaptureAndRun(t, ss.Run, args, "")
+		testutil.AssertExitCode(t, code, core.ExitSuccess)
+		return out.String()
+	}
+	// has reports whether out lists a socket in state with the given
+	// local address.
+	has := func(out, state, local string) bool {
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 6 && fields[1] == state && fields[4] == local {
+				return true
+			}
+		}
+		return false
+	}
+
+	out := run("-tln")
+	if !has(out, "LISTEN", listenAddr) || has(out, "ESTAB", clientAddr) {
+		t.Fatalf("-tln should list only the listener %s:\n%s", listenAddr, out)
+	}
+
+	out = run("-tn")
+	if !has(out, "ESTAB", clientAddr) || has(out, "LISTEN", listenAddr) {
+		t.Fatalf("-tn should list only connected sockets:\n%s", out)
+	}
+
+	out = run("-tan", "state", "established")
+	if !has(out, "ESTAB", clientAddr) || has(out, "LISTEN", listenAddr) {
+		t.Fatalf("state established filter wrong:\n%s", out)
+	}
+
+	out = run("-tan")
+	if !has(out, "ESTAB", clientAddr) || !has(out, "LISTEN", listenAddr) {
+		t.Fatalf("-a should show both sockets:\n%s", out)
+	}
+
+	out = run("-tan", "state", "listening")
+	if has(out, "ESTAB", clientAddr) || !has(out, "LISTEN", listenAddr) {
+		t.Fatalf("state listening filter wrong:\n%s", out)
+	}
+
+	out = run("-tln6")
+	if has(out, "LISTEN", listenAddr) {
+		t.Fatalf("-6 shows IPv4 listener:\n%s", out)
+	}
+
+	out = run("-uln")
+	if !has(out, "UNCONN", udpAddr) || has(out, "LISTEN", listenAddr) {
+		t.Fatalf("-uln should list only the UDP socket %s:\n%s", udpAddr, out)
+	}
+
+	out = run("-tlnp")
+	want := ",pid=" + strconv.Itoa(os.Getpid()) + ",fd="
+	found := false
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, " "+listenAddr+" ") && strings.Contains(line, "users:((\"") && strings.Contains(line, want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("-p missing owner %s for %s:\n%s", want, listenAddr, out)
+	}
+}
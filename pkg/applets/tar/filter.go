@@ -0,0 +1,256 @@
+package tar
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	corefs "github.com/rcarmo/go-busybox/pkg/core/fs"
+)
+
+// excluded reports whether a member name matches any --exclude pattern.
+// As in GNU tar, patterns are unanchored: they may match any run of
+// whole path components, so "*.o" excludes "src/a.o" and "build"
+// excludes "build/x" as well as "a/build".
+func (o *tarOpts) excluded(name string) bool {
+	if len(o.excludes) == 0 {
+		return false
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	if name == "" {
+		return false
+	}
+	for _, pattern := range o.excludes {
+		pattern = strings.TrimSuffix(pattern, "/")
+		for start := 0; start <= len(name); {
+			rest := name[start:]
+			for end := 0; end <= len(rest); {
+				slash := strings.IndexByte(rest[end:], '/')
+				if slash < 0 {
+					end = len(rest)
+				} else {
+					end += slash
+				}
+				if wildcardMatch(pattern, rest[:end]) {
+					return true
+				}
+				end++
+			}
+			next := strings.IndexByte(rest, '/')
+			if next < 0 {
+				break
+			}
+			start += next + 1
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches name against a shell pattern. Unlike path.Match,
+// '*' and '?' also match '/', which is tar's convention.
+func wildcardMatch(pattern, name string) bool {
+	ok, err := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(name, "/", "\x00"))
+	return err == nil && ok
+}
+
+// readExcludeFile appends the patterns listed one per line in file.
+func (o *tarOpts) readExcludeFile(file string) error {
+	f, err := corefs.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			o.excludes = append(o.excludes, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// stripComponents drops the first n components of name. The empty string
+// means nothing is left and the member should be skipped.
+func stripComponents(name string, n int) string {
+	if n <= 0 {
+		return name
+	}
+	parts := strings.Split(name, "/")
+	dropped := 0
+	for len(parts) > 0 && dropped < n {
+		if parts[0] != "" && parts[0] != "." {
+			dropped++
+		}
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "/")
+}
+
+// transform is one sed-style s/REGEX/REPLACEMENT/FLAGS expression from
+// --transform.
+type transform struct {
+	re     *regexp.Regexp
+	repl   string
+	global bool
+}
+
+// parseTransform parses s/REGEX/REPL/[gix]. Any character may replace '/'
+// as the delimiter. REGEX is a basic regular expression unless the x
+// flag is given; REPL may use & and \1 through \9.
+func parseTransform(expr string) (transform, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return transform{}, fmt.Errorf("invalid transform expression '%s'", expr)
+	}
+	delim := expr[1]
+	var parts []string
+	var cur strings.Builder
+	for i := 2; i < len(expr); i++ {
+		c := expr[i]
+		if c == '\\' && i+1 < len(expr) && expr[i+1] == delim {
+			cur.WriteByte(delim)
+			i++
+			continue
+		}
+		if c == '\\' && i+1 < len(expr) {
+			cur.WriteByte(c)
+			cur.WriteByte(expr[i+1])
+			i++
+			continue
+		}
+		if c == delim && len(parts) < 2 {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	if len(parts) != 2 {
+		return transform{}, fmt.Errorf("invalid transform expression '%s'", expr)
+	}
+	t := transform{repl: convertRepl(parts[1])}
+	pattern := parts[0]
+	extended := false
+	prefix := ""
+	for _, f := range cur.String() {
+		switch f {
+		case 'g':
+			t.global = true
+		case 'i':
+			prefix = "(?i)"
+		case 'x':
+			extended = true
+		default:
+			return transform{}, fmt.Errorf("unknown transform flag '%c'", f)
+		}
+	}
+	if !extended {
+		pattern = breToERE(pattern)
+	}
+	re, err := regexp.Compile(prefix + pattern)
+	if err != nil {
+		return transform{}, fmt.Errorf("invalid transform expression '%s': %v", expr, err)
+	}
+	t.re = re
+	return t, nil
+}
+
+// apply rewrites the first match of name, or every match with g.
+func (t transform) apply(name string) string {
+	if t.global {
+		return t.re.ReplaceAllString(name, t.repl)
+	}
+	loc := t.re.FindStringSubmatchIndex(name)
+	if loc == nil {
+		return name
+	}
+	out := t.re.ExpandString(nil, t.repl, name, loc)
+	return name[:loc[0]] + string(out) + name[loc[1]:]
+}
+
+// transformName applies every --transform in order. A trailing '/' on
+// directory names is kept out of reach of the expressions.
+func (o *tarOpts) transformName(name string) string {
+	if len(o.transforms) == 0 {
+		return name
+	}
+	dir := strings.HasSuffix(name, "/")
+	name = strings.TrimSuffix(name, "/")
+	for _, t := range o.transforms {
+		name = t.apply(name)
+	}
+	if dir && name != "" {
+		name += "/"
+	}
+	return name
+}
+
+// breToERE converts POSIX basic regular expression syntax to the RE2
+// syntax used by regexp: \( \) \{ \} \| become operators and the bare
+// characters become literals.
+func breToERE(pat string) string {
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(pat); i++ {
+		c := pat[i]
+		switch {
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+			b.WriteByte(c)
+		case c == '[':
+			inClass = true
+			b.WriteByte(c)
+			if i+1 < len(pat) && pat[i+1] == '^' {
+				b.WriteByte('^')
+				i++
+			}
+			if i+1 < len(pat) && pat[i+1] == ']' {
+				b.WriteByte(']')
+				i++
+			}
+		case c == '\\' && i+1 < len(pat):
+			i++
+			switch pat[i] {
+			case '(', ')', '{', '}', '|', '+', '?':
+				b.WriteByte(pat[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(pat[i])
+			}
+		case c == '(' || c == ')' || c == '{' || c == '}' || c == '|' || c == '+' || c == '?':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// convertRepl converts sed replacement syntax (& and \N) to the ${N}
+// syntax of regexp.Expand.
+func convertRepl(repl string) string {
+	var b strings.Builder
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		switch {
+		case c == '&':
+			b.WriteString("${0}")
+		case c == '\\' && i+1 < len(repl):
+			i++
+			if n := repl[i]; n >= '0' && n <= '9' {
+				b.WriteString("${" + string(n) + "}")
+			} else {
+				b.WriteByte(n)
+			}
+		case c == '$':
+			b.WriteString("$$")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -3,15 +3,19 @@ package tar
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
+	"github.com/rcarmo/go-busybox/pkg/core/archiveutil"
 	corefs "github.com/rcarmo/go-busybox/pkg/core/fs"
 )
 
@@ -22,9 +26,35 @@ type tarOpts struct {
 	extract  bool
 	list     bool
 	verbose  bool
-	gzipped  bool
+	codec    archiveutil.Codec
+	autoComp bool   // -a: pick the codec from the archive name
 	file     string // archive filename, "-" = stdin/stdout
-	dir      string // -C directory
+	dir      string // -C directory in effect after all options
+	excludes []string
+	strip    int // --strip-components
+	// transforms are the --transform expressions, applied in order.
+	transforms []transform
+	// sameOwner restores ownership when extracting as root (-p,
+	// --same-owner).
+	sameOwner bool
+	// noSamePerms masks extracted modes with the umask for non-root users.
+	noSamePerms bool
+	// hardLinks maps files already archived to their member names so
+	// later links to them are stored as hard link entries.
+	hardLinks map[hardLinkKey]string
+}
+
+// hardLinkKey identifies a file by device and inode.
+type hardLinkKey struct {
+	dev uint64
+	ino uint64
+}
+
+// member is a path named on the command line together with the -C
+// directory in effect where it appeared.
+type member struct {
+	path string
+	dir  string
 }
 
 // Run executes the tar command with the given arguments.
@@ -34,27 +64,104 @@ type tarOpts struct {
 //	-c          Create a new archive
 //	-x          Extract files from an archive
 //	-t          List the contents of an archive
-//	-v          Verbose: list files processed
+//	-v          Verbose: list files processed; with -t, list in ls -l style
 //	-z          Filter the archive through gzip
+//	-j          Filter the archive through bzip2
+//	-J          Filter the archive through xz
+//	-a          Pick the compressor from the archive suffix when creating
 //	-f FILE     Use FILE as the archive (use "-" for stdin/stdout)
-//	-C DIR      Change to DIR before extracting/creating
+//	-C DIR      Change to DIR; when creating, it applies to the paths
+//	            that follow it, so several -C options may be given
 //	-O          Extract files to stdout
+//	-p          Restore ownership too when extracting as root
+//	-X FILE     Exclude the patterns listed in FILE
+//	--exclude=PATTERN         Skip members matching PATTERN (repeatable)
+//	--exclude-from=FILE       Same as -X FILE
+//	--strip-components=N      Drop N leading path components on extract
+//	--transform=s/RE/REPL/[gix]  Rewrite member names with a sed-style
+//	                          expression when creating or extracting
+//	--same-owner              Same as -p
+//	--no-same-permissions     Apply the umask to extracted modes (non-root)
 //
 // When -f is "-" or omitted with piped input, the archive is read from
 // or written to stdin/stdout. Supports regular files, directories,
-// symbolic links, and hard links.
+// symbolic links, and hard links. When extracting or listing without a
+// compression flag, gzip, bzip2 and xz archives are detected from their
+// magic bytes. The long forms --gzip, --bzip2, --xz and --auto-compress
+// are accepted.
+//
+// Exclude patterns apply when creating, extracting and listing. '*'
+// matches across '/', and a pattern may match any run of whole path
+// components. Members whose name is stripped away entirely are skipped.
+//
+// Extraction restores modes and modification times, recreates symbolic
+// and hard links, and applies directory metadata after the directory's
+// contents are written. Files sharing an inode are archived once and
+// stored as hard links afterwards.
 func Run(stdio *core.Stdio, args []string) int {
 	opts := tarOpts{}
-	var extra []string
+	var extra []member
 
 	i := 0
 	for i < len(args) {
 		arg := args[i]
 		if arg == "--" {
-			extra = append(extra, args[i+1:]...)
+			for _, path := range args[i+1:] {
+				extra = append(extra, member{path, opts.dir})
+			}
 			break
 		}
 
+		switch arg {
+		case "--gzip", "--gunzip":
+			opts.codec = archiveutil.CodecGzip
+			i++
+			continue
+		case "--bzip2":
+			opts.codec = archiveutil.CodecBzip2
+			i++
+			continue
+		case "--xz":
+			opts.codec = archiveutil.CodecXZ
+			i++
+			continue
+		case "--auto-compress":
+			opts.autoComp = true
+			i++
+			continue
+		case "--same-owner", "--preserve-permissions", "--same-permissions":
+			opts.sameOwner = true
+			i++
+			continue
+		case "--no-same-owner":
+			opts.sameOwner = false
+			i++
+			continue
+		case "--no-same-permissions":
+			opts.noSamePerms = true
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			switch name {
+			case "exclude", "exclude-from", "strip-components", "transform", "xform":
+				if !hasValue {
+					i++
+					if i >= len(args) {
+						return core.UsageError(stdio, "tar", "option '--"+name+"' requires an argument")
+					}
+					value = args[i]
+				}
+				if code := opts.setLong(stdio, name, value); code != core.ExitSuccess {
+					return code
+				}
+				i++
+				continue
+			}
+		}
+
 		// Handle -f with separate argument
 		if arg == "-f" {
 			i++
@@ -72,7 +179,7 @@ func Run(stdio *core.Stdio, args []string) int {
 			if i >= len(args) {
 				return core.UsageError(stdio, "tar", "missing directory")
 			}
-			opts.dir = args[i]
+			opts.chdir(args[i])
 			i++
 			continue
 		}
@@ -95,7 +202,13 @@ func Run(stdio *core.Stdio, args []string) int {
 				case 'v':
 					opts.verbose = true
 				case 'z':
-					opts.gzipped = true
+					opts.codec = archiveutil.CodecGzip
+				case 'j':
+					opts.codec = archiveutil.CodecBzip2
+				case 'J':
+					opts.codec = archiveutil.CodecXZ
+				case 'a':
+					opts.autoComp = true
 				case 'f':
 					// f takes next argument as file
 					if j+1 < len(flags) {
@@ -111,9 +224,19 @@ func Run(stdio *core.Stdio, args []string) int {
 					}
 				case 'C':
 					if nextI < len(args) {
-						opts.dir = args[nextI]
+						opts.chdir(args[nextI])
 						nextI++
 					}
+				case 'X':
+					if nextI >= len(args) {
+						return core.UsageError(stdio, "tar", "missing exclude file")
+					}
+					if code := opts.setLong(stdio, "exclude-from", args[nextI]); code != core.ExitSuccess {
+						return code
+					}
+					nextI++
+				case 'p':
+					opts.sameOwner = true
 				case 'O':
 					// extract to stdout - ignore
 				default:
@@ -124,7 +247,7 @@ func Run(stdio *core.Stdio, args []string) int {
 			continue
 		}
 
-		extra = append(extra, arg)
+		extra = append(extra, member{arg, opts.dir})
 		i++
 	}
 
@@ -146,7 +269,50 @@ func Run(stdio *core.Stdio, args []string) int {
 	return core.UsageError(stdio, "tar", "must specify one of -c, -x, -t")
 }
 
-func createArchiveCmd(stdio *core.Stdio, opts *tarOpts, paths []string) int {
+// setLong applies a long option that takes a value.
+func (o *tarOpts) setLong(stdio *core.Stdio, name, value string) int {
+	switch name {
+	case "exclude":
+		o.excludes = append(o.excludes, value)
+	case "exclude-from":
+		if err := o.readExcludeFile(value); err != nil {
+			stdio.Errorf("tar: %v\n", err)
+			return core.ExitFailure
+		}
+	case "strip-components":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return core.UsageError(stdio, "tar", "invalid number of elements: '"+value+"'")
+		}
+		o.strip = n
+	case "transform", "xform":
+		t, err := parseTransform(value)
+		if err != nil {
+			return core.UsageError(stdio, "tar", err.Error())
+		}
+		o.transforms = append(o.transforms, t)
+	}
+	return core.ExitSuccess
+}
+
+// chdir records a -C option. Like GNU tar, a relative directory is taken
+// relative to the one named by the previous -C.
+func (o *tarOpts) chdir(dir string) {
+	if o.dir != "" && !filepath.IsAbs(dir) {
+		dir = filepath.Join(o.dir, dir)
+	}
+	o.dir = dir
+}
+
+// inDir resolves a path relative to the -C directory dir.
+func inDir(dir, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func createArchiveCmd(stdio *core.Stdio, opts *tarOpts, members []member) int {
 	var out io.WriteCloser
 	if opts.file == "-" {
 		out = nopWriteCloser{stdio.Out}
@@ -160,51 +326,91 @@ func createArchiveCmd(stdio *core.Stdio, opts *tarOpts, paths []string) int {
 		out = f
 	}
 
-	var w io.WriteCloser = out
-	if opts.gzipped {
-		gz := gzip.NewWriter(out)
-		defer gz.Close()
-		w = gz
+	codec := opts.codec
+	if codec == archiveutil.CodecNone && opts.autoComp {
+		codec = archiveutil.CodecForName(opts.file)
+	}
+	w, err := archiveutil.NewCodecWriter(codec, out)
+	if err != nil {
+		stdio.Errorf("tar: %v\n", err)
+		return core.ExitFailure
 	}
 
 	tw := tar.NewWriter(w)
-	defer tw.Close()
-
-	for _, path := range paths {
-		if err := addPath(tw, path, "", opts.verbose, stdio); err != nil {
+	opts.hardLinks = make(map[hardLinkKey]string)
+	for _, m := range members {
+		if err := addPath(tw, inDir(m.dir, m.path), m.path, opts, stdio); err != nil {
 			stdio.Errorf("tar: %v\n", err)
 			return core.ExitFailure
 		}
 	}
+	if err := tw.Close(); err != nil {
+		stdio.Errorf("tar: %v\n", err)
+		return core.ExitFailure
+	}
+	if err := w.Close(); err != nil {
+		stdio.Errorf("tar: %v\n", err)
+		return core.ExitFailure
+	}
 	return core.ExitSuccess
 }
 
-func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
+// openArchive opens the archive for reading and strips any compression.
+// Without an explicit codec the format is detected from the magic bytes.
+func openArchive(stdio *core.Stdio, opts *tarOpts) (io.ReadCloser, error) {
 	var in io.Reader
+	var file io.Closer
 	if opts.file == "-" {
 		in = stdio.In
 	} else {
 		f, err := corefs.Open(opts.file)
 		if err != nil {
-			stdio.Errorf("tar: %v\n", err)
-			return core.ExitFailure
+			return nil, err
 		}
-		defer f.Close()
 		in = f
+		file = f
 	}
-
-	if opts.gzipped {
-		gz, err := gzip.NewReader(in)
-		if err != nil {
-			stdio.Errorf("tar: %v\n", err)
-			return core.ExitFailure
+	codec := opts.codec
+	if codec == archiveutil.CodecNone {
+		br := bufio.NewReader(in)
+		head, _ := br.Peek(6)
+		codec = archiveutil.DetectCodec(head)
+		in = br
+	}
+	r, err := archiveutil.NewCodecReader(codec, in)
+	if err != nil {
+		if file != nil {
+			_ = file.Close()
 		}
-		defer gz.Close()
-		in = gz
+		return nil, err
+	}
+	return archiveCloser{r, file}, nil
+}
+
+// archiveCloser closes the decompressor and then the underlying file.
+type archiveCloser struct {
+	io.ReadCloser
+	file io.Closer
+}
+
+func (a archiveCloser) Close() error {
+	err := a.ReadCloser.Close()
+	if a.file != nil {
+		_ = a.file.Close()
 	}
+	return err
+}
+
+func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
+	in, err := openArchive(stdio, opts)
+	if err != nil {
+		stdio.Errorf("tar: %v\n", err)
+		return core.ExitFailure
+	}
+	defer in.Close()
 
 	if opts.dir != "" {
-		if err := os.Chdir(opts.dir); err != nil {
+		if _, err := corefs.Stat(opts.dir); err != nil {
 			stdio.Errorf("tar: %v\n", err)
 			return core.ExitFailure
 		}
@@ -214,6 +420,9 @@ func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
 	pr := &peekReader{r: in}
 	tr := tar.NewReader(pr)
 	var totalBytes int64
+	// Directory metadata is applied at the end so that read-only
+	// directories can still be filled and their mtimes survive.
+	var dirs []dirEntry
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -222,7 +431,7 @@ func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
 				stdio.Errorf("tar: short read\n")
 				return core.ExitFailure
 			}
-			return core.ExitSuccess
+			return restoreDirs(stdio, opts, dirs)
 		}
 		if err != nil {
 			// Check if this is an empty tarball (just zero blocks)
@@ -242,17 +451,32 @@ func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
 			stdio.Errorf("tar: archive too large\n")
 			return core.ExitFailure
 		}
-		target := hdr.Name
+		if opts.excluded(hdr.Name) {
+			continue
+		}
+		name := opts.transformName(stripComponents(hdr.Name, opts.strip))
+		if name == "" {
+			continue
+		}
+		target := inDir(opts.dir, name)
 		if opts.verbose {
-			stdio.Printf("%s\n", target)
+			stdio.Printf("%s\n", hdr.Name)
 		}
 
+		if hdr.Typeflag != tar.TypeDir {
+			if err := corefs.MkdirAll(filepath.Dir(target), 0750); err != nil {
+				stdio.Errorf("tar: %v\n", err)
+				return core.ExitFailure
+			}
+		}
 		switch hdr.Typeflag {
 		case tar.TypeDir:
-			if err := corefs.MkdirAll(target, hdr.FileInfo().Mode()); err != nil {
+			if err := corefs.MkdirAll(target, 0700); err != nil {
 				stdio.Errorf("tar: %v\n", err)
 				return core.ExitFailure
 			}
+			dirs = append(dirs, dirEntry{target, hdr})
+			continue
 		case tar.TypeSymlink:
 			_ = os.Remove(target)
 			if err := os.Symlink(hdr.Linkname, target); err != nil {
@@ -260,17 +484,16 @@ func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
 				return core.ExitFailure
 			}
 		case tar.TypeLink:
+			// A hard link shares the metadata of the file it points to.
 			_ = os.Remove(target)
-			if err := os.Link(hdr.Linkname, target); err != nil {
+			link := opts.transformName(stripComponents(hdr.Linkname, opts.strip))
+			if err := os.Link(inDir(opts.dir, link), target); err != nil {
 				stdio.Errorf("tar: %v\n", err)
 				return core.ExitFailure
 			}
+			continue
 		default:
-			if err := corefs.MkdirAll(filepath.Dir(target), 0750); err != nil {
-				stdio.Errorf("tar: %v\n", err)
-				return core.ExitFailure
-			}
-			out, err := corefs.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode()&0777)
+			out, err := corefs.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 			if err != nil {
 				stdio.Errorf("tar: %v\n", err)
 				return core.ExitFailure
@@ -282,34 +505,89 @@ func extractArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
 			}
 			_ = out.Close()
 		}
+		if err := opts.restoreMetadata(target, hdr); err != nil {
+			stdio.Errorf("tar: %s: %v\n", name, err)
+			return core.ExitFailure
+		}
 	}
 }
 
-func listArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
-	var in io.Reader
-	if opts.file == "-" {
-		in = stdio.In
-	} else {
-		f, err := corefs.Open(opts.file)
-		if err != nil {
-			stdio.Errorf("tar: %v\n", err)
+// dirEntry is an extracted directory awaiting its metadata.
+type dirEntry struct {
+	path string
+	hdr  *tar.Header
+}
+
+// restoreDirs applies directory metadata deepest first, so that setting
+// a parent's mtime is not undone by changes to its children.
+func restoreDirs(stdio *core.Stdio, opts *tarOpts, dirs []dirEntry) int {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := opts.restoreMetadata(dirs[i].path, dirs[i].hdr); err != nil {
+			stdio.Errorf("tar: %s: %v\n", dirs[i].hdr.Name, err)
 			return core.ExitFailure
 		}
-		defer f.Close()
-		in = f
 	}
+	return core.ExitSuccess
+}
+
+// restoreMetadata applies the ownership, mode and mtime recorded in hdr
+// to target. Ownership is only restored for root with -p or --same-owner,
+// and symbolic links only get their ownership.
+func (o *tarOpts) restoreMetadata(target string, hdr *tar.Header) error {
+	if o.sameOwner && os.Geteuid() == 0 {
+		uid, gid := headerOwner(hdr)
+		if err := os.Lchown(target, uid, gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if o.noSamePerms && os.Geteuid() != 0 {
+		mode &^= currentUmask()
+	}
+	if err := os.Chmod(target, mode); err != nil {
+		return err
+	}
+	atime := hdr.AccessTime
+	if atime.IsZero() {
+		atime = hdr.ModTime
+	}
+	return corefs.Chtimes(target, atime, hdr.ModTime)
+}
 
-	if opts.gzipped {
-		gz, err := gzip.NewReader(in)
-		if err != nil {
-			stdio.Errorf("tar: %v\n", err)
-			return core.ExitFailure
+// headerOwner returns the owner recorded in hdr, preferring the user and
+// group names when they exist on this system.
+func headerOwner(hdr *tar.Header) (int, int) {
+	uid, gid := hdr.Uid, hdr.Gid
+	if hdr.Uname != "" {
+		if u, err := user.Lookup(hdr.Uname); err == nil {
+			if id, err := strconv.Atoi(u.Uid); err == nil {
+				uid = id
+			}
 		}
-		defer gz.Close()
-		in = gz
 	}
+	if hdr.Gname != "" {
+		if g, err := user.LookupGroup(hdr.Gname); err == nil {
+			if id, err := strconv.Atoi(g.Gid); err == nil {
+				gid = id
+			}
+		}
+	}
+	return uid, gid
+}
+
+func listArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
+	in, err := openArchive(stdio, opts)
+	if err != nil {
+		stdio.Errorf("tar: %v\n", err)
+		return core.ExitFailure
+	}
+	defer in.Close()
 
 	tr := tar.NewReader(in)
+	ugsWidth := 19
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -319,63 +597,158 @@ func listArchiveCmd(stdio *core.Stdio, opts *tarOpts) int {
 			stdio.Errorf("tar: %v\n", err)
 			return core.ExitFailure
 		}
+		if opts.excluded(hdr.Name) {
+			continue
+		}
 		if opts.verbose {
-			stdio.Printf("%s %d %s\n", hdr.FileInfo().Mode(), hdr.Size, hdr.Name)
+			stdio.Println(formatLong(hdr, &ugsWidth))
 		} else {
 			stdio.Printf("%s\n", hdr.Name)
 		}
 	}
 }
 
+// formatLong renders a -tv line the way GNU tar does:
+//
+//	-rw-r--r-- user/group      1234 2006-01-02 15:04 name
+//
+// The owner and size share a column that starts 19 characters wide and
+// grows, for the rest of the listing, when an entry does not fit.
+// Symbolic and hard links are followed by " -> target".
+func formatLong(hdr *tar.Header, ugsWidth *int) string {
+	owner := hdr.Uname
+	if owner == "" {
+		owner = strconv.Itoa(hdr.Uid)
+	}
+	group := hdr.Gname
+	if group == "" {
+		group = strconv.Itoa(hdr.Gid)
+	}
+	size := strconv.FormatInt(hdr.Size, 10)
+	if hdr.Typeflag == tar.TypeChar || hdr.Typeflag == tar.TypeBlock {
+		size = fmt.Sprintf("%d,%d", hdr.Devmajor, hdr.Devminor)
+	}
+	pad := len(owner) + 1 + len(group) + 1 + len(size)
+	if pad > *ugsWidth {
+		*ugsWidth = pad
+	}
+	line := fmt.Sprintf("%s %s/%s %*s %s %s", modeString(hdr), owner, group,
+		*ugsWidth-pad+len(size), size, hdr.ModTime.Local().Format("2006-01-02 15:04"), hdr.Name)
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+		line += " -> " + hdr.Linkname
+	}
+	return line
+}
+
+// modeString renders the type and permission bits of a member like
+// ls -l, e.g. drwxr-xr-x. Hard links are shown as regular files.
+func modeString(hdr *tar.Header) string {
+	var b [10]byte
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		b[0] = 'd'
+	case tar.TypeSymlink:
+		b[0] = 'l'
+	case tar.TypeChar:
+		b[0] = 'c'
+	case tar.TypeBlock:
+		b[0] = 'b'
+	case tar.TypeFifo:
+		b[0] = 'p'
+	default:
+		b[0] = '-'
+	}
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if hdr.Mode&(1<<(8-i)) != 0 {
+			b[i+1] = rwx[i]
+		} else {
+			b[i+1] = '-'
+		}
+	}
+	special := []struct {
+		bit  int64
+		pos  int
+		char byte
+	}{{04000, 3, 's'}, {02000, 6, 's'}, {01000, 9, 't'}}
+	for _, sp := range special {
+		if hdr.Mode&sp.bit == 0 {
+			continue
+		}
+		if b[sp.pos] == 'x' {
+			b[sp.pos] = sp.char
+		} else {
+			b[sp.pos] = sp.char - 'a' + 'A'
+		}
+	}
+	return string(b[:])
+}
+
 func isUnexpectedEOF(err error) bool {
 	return errors.Is(err, io.ErrUnexpectedEOF) || err.Error() == "unexpected EOF"
 }
 
-func addPath(tw *tar.Writer, path string, prefix string, verbose bool, stdio *core.Stdio) error {
-	info, err := corefs.Stat(path)
+// addPath writes src, and the tree below it, to the archive under name.
+// Symbolic links are stored as links, and a file already archived under
+// another name is stored as a hard link to it.
+func addPath(tw *tar.Writer, src string, name string, opts *tarOpts, stdio *core.Stdio) error {
+	if opts.excluded(name) {
+		return nil
+	}
+	info, err := corefs.Lstat(src)
 	if err != nil {
 		return err
 	}
-	name := path
-	if prefix != "" {
-		name = filepath.Join(prefix, filepath.Base(path))
-	}
-	if info.IsDir() {
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(src); err != nil {
 			return err
 		}
-		header.Name = strings.TrimSuffix(name, string(os.PathSeparator)) + "/"
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		header.Name = opts.transformName(strings.TrimSuffix(name, string(os.PathSeparator)) + "/")
 		if err := tw.WriteHeader(header); err != nil {
 			return err
 		}
-		if verbose {
+		if opts.verbose {
 			fmt.Fprintf(stdio.Out, "%s\n", header.Name)
 		}
-		entries, err := corefs.ReadDir(path)
+		entries, err := corefs.ReadDir(src)
 		if err != nil {
 			return err
 		}
 		for _, entry := range entries {
-			child := filepath.Join(path, entry.Name())
-			if err := addPath(tw, child, name, verbose, stdio); err != nil {
+			if err := addPath(tw, filepath.Join(src, entry.Name()), filepath.Join(name, entry.Name()), opts, stdio); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
-	header, err := tar.FileInfoHeader(info, "")
-	if err != nil {
-		return err
+	header.Name = opts.transformName(name)
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && stat.Nlink > 1 {
+		key := hardLinkKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+		if first, found := opts.hardLinks[key]; found {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+		} else if opts.hardLinks != nil {
+			opts.hardLinks[key] = header.Name
+		}
 	}
-	header.Name = name
 	if err := tw.WriteHeader(header); err != nil {
 		return err
 	}
-	if verbose {
+	if opts.verbose {
 		fmt.Fprintf(stdio.Out, "%s\n", header.Name)
 	}
-	in, err := corefs.Open(path)
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+	in, err := corefs.Open(src)
 	if err != nil {
 		return err
 	}
@@ -3,7 +3,12 @@ package tar_test
 import (
 	"archive/tar"
 	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	tarapplet "github.com/rcarmo/go-busybox/pkg/applets/tar"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -43,6 +48,478 @@ func TestTar(t *testing.T) {
 	testutil.RunAppletTests(t, tarapplet.Run, tests)
 }
 
+// compressedTree is the small tree round-tripped through each codec.
+var compressedTree = map[string]string{
+	"tree/a.txt":     "alpha\n",
+	"tree/sub/b.txt": strings.Repeat("bravo charlie delta\n", 200),
+	"tree/sub/z.bin": string(bytes.Repeat([]byte{0}, 5000)),
+}
+
+// extractInto runs tar with args inside a fresh directory "out" under dir
+// and checks that the tree came back intact.
+func extractInto(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	out := filepath.Join(dir, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, append(args, "-C", out), "")
+	if code != core.ExitSuccess {
+		t.Fatalf("tar %v: exit %d: %s", args, code, errBuf.String())
+	}
+	for name, want := range compressedTree {
+		testutil.AssertFileContent(t, filepath.Join(out, name), want)
+	}
+}
+
+func assertMagic(t *testing.T, path string, magic string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), magic) {
+		t.Fatalf("%s starts with %q, want %q", path, data[:min(len(data), 6)], magic)
+	}
+}
+
+func TestTarCompression(t *testing.T) {
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "gzip",
+			Args:     []string{"-czf", "a.tar.gz", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				assertMagic(t, filepath.Join(dir, "a.tar.gz"), "\x1f\x8b")
+				extractInto(t, dir, "-xzf", filepath.Join(dir, "a.tar.gz"))
+			},
+		},
+		{
+			Name:     "bzip2",
+			Args:     []string{"-cjf", "a.tar.bz2", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				assertMagic(t, filepath.Join(dir, "a.tar.bz2"), "BZh")
+				extractInto(t, dir, "-xjf", filepath.Join(dir, "a.tar.bz2"))
+			},
+		},
+		{
+			Name:     "xz",
+			Args:     []string{"-cJf", "a.tar.xz", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				assertMagic(t, filepath.Join(dir, "a.tar.xz"), "\xfd7zXZ\x00")
+				extractInto(t, dir, "-xJf", filepath.Join(dir, "a.tar.xz"))
+			},
+		},
+		{
+			Name:     "autodetect_gzip",
+			Args:     []string{"-czf", "a.tgz", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				extractInto(t, dir, "-xf", filepath.Join(dir, "a.tgz"))
+			},
+		},
+		{
+			Name:     "autodetect_bzip2",
+			Args:     []string{"--bzip2", "-cf", "a.tbz", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				extractInto(t, dir, "-xf", filepath.Join(dir, "a.tbz"))
+			},
+		},
+		{
+			Name:     "autodetect_xz",
+			Args:     []string{"-cJf", "a.txz", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				extractInto(t, dir, "-xf", filepath.Join(dir, "a.txz"))
+				out, _, code := testutil.CaptureAndRun(t, tarapplet.Run, []string{"-tf", filepath.Join(dir, "a.txz")}, "")
+				testutil.AssertExitCode(t, code, core.ExitSuccess)
+				testutil.AssertOutputContains(t, out.String(), "tree/sub/b.txt\n")
+			},
+		},
+		{
+			Name:     "auto_compress_from_name",
+			Args:     []string{"-caf", "a.tar.bz2", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				assertMagic(t, filepath.Join(dir, "a.tar.bz2"), "BZh")
+				extractInto(t, dir, "-xf", filepath.Join(dir, "a.tar.bz2"))
+			},
+		},
+		{
+			Name:     "auto_compress_plain",
+			Args:     []string{"-caf", "a.tar", "tree"},
+			WantCode: core.ExitSuccess,
+			Files:    compressedTree,
+			Check: func(t *testing.T, dir string) {
+				assertMagic(t, filepath.Join(dir, "a.tar"), "tree/")
+			},
+		},
+		{
+			Name:       "xz_stdout",
+			Args:       []string{"-cJ", "tree"},
+			WantCode:   core.ExitSuccess,
+			Files:      compressedTree,
+			WantOutSub: "\xfd7zXZ\x00",
+		},
+	}
+	testutil.RunAppletTests(t, tarapplet.Run, tests)
+}
+
+// releaseTree mimics an unpacked release tarball with build debris.
+var releaseTree = map[string]string{
+	"pkg-1.0/README":          "readme\n",
+	"pkg-1.0/src/main.c":      "int main;\n",
+	"pkg-1.0/src/main.o":      "obj",
+	"pkg-1.0/build/cache/x.o": "obj",
+	"pkg-1.0/logs/run.log":    "log\n",
+}
+
+func listMembers(t *testing.T, archive string, args ...string) string {
+	t.Helper()
+	out, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, append([]string{"-tf", archive}, args...), "")
+	if code != core.ExitSuccess {
+		t.Fatalf("tar -tf: exit %d: %s", code, errBuf.String())
+	}
+	return out.String()
+}
+
+func TestTarExclude(t *testing.T) {
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "exclude_on_create",
+			Args:     []string{"-cf", "a.tar", "--exclude=*.o", "--exclude", "logs", "pkg-1.0"},
+			WantCode: core.ExitSuccess,
+			Files:    releaseTree,
+			Check: func(t *testing.T, dir string) {
+				got := listMembers(t, filepath.Join(dir, "a.tar"))
+				for _, name := range []string{"pkg-1.0/README", "pkg-1.0/src/main.c", "pkg-1.0/build/"} {
+					testutil.AssertOutputContains(t, got, name+"\n")
+				}
+				for _, name := range []string{".o", "logs", "run.log"} {
+					if strings.Contains(got, name) {
+						t.Errorf("archive contains %q:\n%s", name, got)
+					}
+				}
+			},
+		},
+		{
+			Name:     "star_crosses_slash",
+			Args:     []string{"-cf", "a.tar", "--exclude=pkg-1.0/*/main*", "pkg-1.0"},
+			WantCode: core.ExitSuccess,
+			Files:    releaseTree,
+			Check: func(t *testing.T, dir string) {
+				got := listMembers(t, filepath.Join(dir, "a.tar"))
+				if strings.Contains(got, "main") {
+					t.Errorf("archive contains main.*:\n%s", got)
+				}
+				testutil.AssertOutputContains(t, got, "pkg-1.0/build/cache/x.o\n")
+			},
+		},
+		{
+			Name:     "exclude_from_on_extract",
+			Args:     []string{"-cf", "a.tar", "pkg-1.0"},
+			WantCode: core.ExitSuccess,
+			Files:    releaseTree,
+			Check: func(t *testing.T, dir string) {
+				list := testutil.TempFileIn(t, dir, "skip.lst", "*.o\nbuild\n")
+				out := filepath.Join(dir, "out")
+				if err := os.Mkdir(out, 0755); err != nil {
+					t.Fatal(err)
+				}
+				_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, []string{"-xf", filepath.Join(dir, "a.tar"), "-X", list, "-C", out}, "")
+				if code != core.ExitSuccess {
+					t.Fatalf("exit %d: %s", code, errBuf.String())
+				}
+				testutil.AssertFileContent(t, filepath.Join(out, "pkg-1.0/src/main.c"), "int main;\n")
+				testutil.AssertFileNotExists(t, filepath.Join(out, "pkg-1.0/src/main.o"))
+				testutil.AssertFileNotExists(t, filepath.Join(out, "pkg-1.0/build"))
+				got := listMembers(t, filepath.Join(dir, "a.tar"), "--exclude-from="+list)
+				if strings.Contains(got, "build") {
+					t.Errorf("listing contains build:\n%s", got)
+				}
+			},
+		},
+		{
+			Name:     "strip_components",
+			Args:     []string{"-cf", "a.tar", "--exclude=*.log", "pkg-1.0"},
+			WantCode: core.ExitSuccess,
+			Files:    releaseTree,
+			Check: func(t *testing.T, dir string) {
+				out := filepath.Join(dir, "out")
+				if err := os.Mkdir(out, 0755); err != nil {
+					t.Fatal(err)
+				}
+				_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, []string{"-xf", filepath.Join(dir, "a.tar"), "--strip-components=1", "-C", out}, "")
+				if code != core.ExitSuccess {
+					t.Fatalf("exit %d: %s", code, errBuf.String())
+				}
+				testutil.AssertFileContent(t, filepath.Join(out, "README"), "readme\n")
+				testutil.AssertFileContent(t, filepath.Join(out, "src/main.c"), "int main;\n")
+				testutil.AssertFileNotExists(t, filepath.Join(out, "pkg-1.0"))
+				testutil.AssertFileNotExists(t, filepath.Join(out, "logs/run.log"))
+			},
+		},
+		{
+			Name:     "strip_everything",
+			Args:     []string{"-xf", "archive.tar", "--strip-components", "1"},
+			WantCode: core.ExitSuccess,
+			Setup: func(t *testing.T, dir string) {
+				testutil.TempFileIn(t, dir, "archive.tar", buildTarBytes(t))
+			},
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileNotExists(t, filepath.Join(dir, "file.txt"))
+			},
+		},
+		{
+			Name:     "bad_strip_count",
+			Args:     []string{"-xf", "archive.tar", "--strip-components=x"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid number of elements",
+		},
+	}
+	testutil.RunAppletTests(t, tarapplet.Run, tests)
+}
+
+func TestTarDirectoryAndTransform(t *testing.T) {
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "per_argument_C_on_create",
+			Args:     []string{"-cf", "a.tar", "-C", "a", "f1", "-C", "../b", "f2", "sub"},
+			WantCode: core.ExitSuccess,
+			Files: map[string]string{
+				"a/f1":     "one\n",
+				"a/f2":     "wrong\n",
+				"b/f2":     "two\n",
+				"b/sub/f3": "three\n",
+			},
+			Check: func(t *testing.T, dir string) {
+				got := listMembers(t, filepath.Join(dir, "a.tar"))
+				if got != "f1\nf2\nsub/\nsub/f3\n" {
+					t.Fatalf("members = %q", got)
+				}
+				out := filepath.Join(dir, "out")
+				if err := os.Mkdir(out, 0755); err != nil {
+					t.Fatal(err)
+				}
+				_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, []string{"-C", out, "-xf", filepath.Join(dir, "a.tar")}, "")
+				if code != core.ExitSuccess {
+					t.Fatalf("exit %d: %s", code, errBuf.String())
+				}
+				testutil.AssertFileContent(t, filepath.Join(out, "f1"), "one\n")
+				testutil.AssertFileContent(t, filepath.Join(out, "f2"), "two\n")
+				testutil.AssertFileContent(t, filepath.Join(out, "sub/f3"), "three\n")
+			},
+		},
+		{
+			Name:     "transform_on_extract",
+			Args:     []string{"-cf", "a.tar", "pkg-1.0"},
+			WantCode: core.ExitSuccess,
+			Files:    releaseTree,
+			Check: func(t *testing.T, dir string) {
+				out := filepath.Join(dir, "out")
+				if err := os.Mkdir(out, 0755); err != nil {
+					t.Fatal(err)
+				}
+				args := []string{"-xf", filepath.Join(dir, "a.tar"), "-C", out,
+					"--transform=s,^pkg-\\([0-9.]*\\),pkg/v\\1,", "--transform", "s/\\.c$/.c.orig/"}
+				_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, args, "")
+				if code != core.ExitSuccess {
+					t.Fatalf("exit %d: %s", code, errBuf.String())
+				}
+				testutil.AssertFileContent(t, filepath.Join(out, "pkg/v1.0/README"), "readme\n")
+				testutil.AssertFileContent(t, filepath.Join(out, "pkg/v1.0/src/main.c.orig"), "int main;\n")
+				testutil.AssertFileNotExists(t, filepath.Join(out, "pkg-1.0"))
+			},
+		},
+		{
+			Name:     "transform_on_create",
+			Args:     []string{"-cf", "a.tar", "--transform=s/o/0/g", "pkg-1.0/logs"},
+			WantCode: core.ExitSuccess,
+			Files:    releaseTree,
+			Check: func(t *testing.T, dir string) {
+				got := listMembers(t, filepath.Join(dir, "a.tar"))
+				if got != "pkg-1.0/l0gs/\npkg-1.0/l0gs/run.l0g\n" {
+					t.Fatalf("members = %q", got)
+				}
+			},
+		},
+		{
+			Name:     "bad_transform",
+			Args:     []string{"-xf", "a.tar", "--transform=s/a/b"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid transform expression",
+		},
+	}
+	testutil.RunAppletTests(t, tarapplet.Run, tests)
+}
+
+func TestTarMetadata(t *testing.T) {
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	setup := func(t *testing.T, dir string) {
+		root := filepath.Join(dir, "tree")
+		testutil.TempFileIn(t, root, "secret", "key\n")
+		testutil.TempFileIn(t, root, "ro/data", "data\n")
+		must := func(err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		must(os.Chmod(filepath.Join(root, "secret"), 0600))
+		must(os.Symlink("secret", filepath.Join(root, "link")))
+		must(os.Symlink("missing", filepath.Join(root, "dangling")))
+		must(os.Link(filepath.Join(root, "secret"), filepath.Join(root, "hard")))
+		must(os.Chtimes(filepath.Join(root, "secret"), mtime, mtime))
+		must(os.Chmod(filepath.Join(root, "ro"), 0555))
+		must(os.Chtimes(filepath.Join(root, "ro"), mtime, mtime))
+		t.Cleanup(func() { _ = os.Chmod(filepath.Join(root, "ro"), 0755) })
+	}
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "round_trip",
+			Args:     []string{"-cf", "a.tar", "tree"},
+			WantCode: core.ExitSuccess,
+			Setup:    setup,
+			Check: func(t *testing.T, dir string) {
+				got := listMembers(t, filepath.Join(dir, "a.tar"))
+				if strings.Count(got, "tree/hard\n")+strings.Count(got, "tree/secret\n") != 2 {
+					t.Fatalf("members = %q", got)
+				}
+				out := filepath.Join(dir, "out")
+				if err := os.Mkdir(out, 0755); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { _ = os.Chmod(filepath.Join(out, "tree/ro"), 0755) })
+				_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, []string{"-xf", filepath.Join(dir, "a.tar"), "-C", out}, "")
+				if code != core.ExitSuccess {
+					t.Fatalf("exit %d: %s", code, errBuf.String())
+				}
+				tree := filepath.Join(out, "tree")
+
+				secret, err := os.Stat(filepath.Join(tree, "secret"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if secret.Mode().Perm() != 0600 {
+					t.Errorf("secret mode = %v, want 0600", secret.Mode().Perm())
+				}
+				if !secret.ModTime().Equal(mtime) {
+					t.Errorf("secret mtime = %v, want %v", secret.ModTime(), mtime)
+				}
+				hard, err := os.Stat(filepath.Join(tree, "hard"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !os.SameFile(secret, hard) {
+					t.Errorf("hard is a copy, not a hard link to secret")
+				}
+
+				for link, want := range map[string]string{"link": "secret", "dangling": "missing"} {
+					if target, err := os.Readlink(filepath.Join(tree, link)); err != nil || target != want {
+						t.Errorf("readlink %s = %q, %v; want %q", link, target, err, want)
+					}
+				}
+
+				ro, err := os.Stat(filepath.Join(tree, "ro"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ro.Mode().Perm() != 0555 || !ro.ModTime().Equal(mtime) {
+					t.Errorf("ro = %v %v, want 0555 %v", ro.Mode().Perm(), ro.ModTime(), mtime)
+				}
+				testutil.AssertFileContent(t, filepath.Join(tree, "ro/data"), "data\n")
+			},
+		},
+		{
+			Name:     "same_owner",
+			Args:     []string{"-cf", "a.tar", "owned"},
+			WantCode: core.ExitSuccess,
+			Setup: func(t *testing.T, dir string) {
+				if os.Geteuid() != 0 {
+					t.Skip("needs root")
+				}
+				path := testutil.TempFileIn(t, dir, "owned", "x")
+				if err := os.Chown(path, 4321, 4321); err != nil {
+					t.Skip(err)
+				}
+			},
+			Check: func(t *testing.T, dir string) {
+				for _, tc := range []struct {
+					flag string
+					uid  uint32
+				}{{"-x", 0}, {"-xp", 4321}} {
+					out, err := os.MkdirTemp(dir, "out")
+					if err != nil {
+						t.Fatal(err)
+					}
+					_, errBuf, code := testutil.CaptureAndRun(t, tarapplet.Run, []string{tc.flag, "-f", filepath.Join(dir, "a.tar"), "-C", out}, "")
+					if code != core.ExitSuccess {
+						t.Fatalf("exit %d: %s", code, errBuf.String())
+					}
+					info, err := os.Stat(filepath.Join(out, "owned"))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if uid := info.Sys().(*syscall.Stat_t).Uid; uid != tc.uid {
+						t.Errorf("%s: uid = %d, want %d", tc.flag, uid, tc.uid)
+					}
+				}
+			},
+		},
+	}
+	testutil.RunAppletTests(t, tarapplet.Run, tests)
+}
+
+func TestTarListLong(t *testing.T) {
+	mtime := time.Date(2023, 11, 5, 9, 7, 0, 0, time.Local)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	headers := []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755, Uname: "root", Gname: "root", ModTime: mtime},
+		{Typeflag: tar.TypeReg, Name: "dir/file.txt", Mode: 0640, Uname: "alice", Gname: "staff", Size: 1234, ModTime: mtime},
+		{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "file.txt", Mode: 0777, Uname: "root", Gname: "root", ModTime: mtime},
+		{Typeflag: tar.TypeReg, Name: "dir/tool", Mode: 04755, Uid: 1000, Gid: 100, ModTime: mtime},
+		{Typeflag: tar.TypeReg, Name: "dir/big", Mode: 0644, Uname: "averylongusername", Gname: "averylonggroup", Size: 7, ModTime: mtime},
+		{Typeflag: tar.TypeReg, Name: "dir/after", Mode: 0644, Uname: "root", Gname: "root", ModTime: mtime},
+	}
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(make([]byte, hdr.Size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testutil.RunAppletTests(t, tarapplet.Run, []testutil.AppletTestCase{
+		{
+			Name:     "tv",
+			Args:     []string{"-tvf", "-"},
+			Input:    buf.String(),
+			WantCode: core.ExitSuccess,
+			WantOut: "drwxr-xr-x root/root         0 2023-11-05 09:07 dir/\n" +
+				"-rw-r----- alice/staff    1234 2023-11-05 09:07 dir/file.txt\n" +
+				"lrwxrwxrwx root/root         0 2023-11-05 09:07 dir/link -> file.txt\n" +
+				"-rwsr-xr-x 1000/100          0 2023-11-05 09:07 dir/tool\n" +
+				"-rw-r--r-- averylongusername/averylonggroup 7 2023-11-05 09:07 dir/big\n" +
+				"-rw-r--r-- root/root                        0 2023-11-05 09:07 dir/after\n",
+		},
+	})
+}
+
 func buildTarBytes(t *testing.T) string {
 	t.Helper()
 	var buf bytes.Buffer
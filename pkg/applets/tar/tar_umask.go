@@ -0,0 +1,16 @@
+//go:build !js && !wasm && !wasip1
+
+package tar
+
+import (
+	"os"
+	"syscall"
+)
+
+// currentUmask returns the process umask. Reading it means setting it,
+// so the old value is put straight back.
+func currentUmask() os.FileMode {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask)
+}
@@ -0,0 +1,11 @@
+//go:build js || wasm || wasip1
+
+package tar
+
+import "os"
+
+// currentUmask returns the conventional 022; WASM platforms have no
+// process umask.
+func currentUmask() os.FileMode {
+	return 0o022
+}
@@ -4,8 +4,10 @@
 package timeout
 
 import (
+	"errors"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
 	"syscall"
 	"time"
@@ -15,49 +17,93 @@ import (
 	"github.com/rcarmo/go-busybox/pkg/core/timeutil"
 )
 
+// exitTimedOut is the status reported when the command had to be
+// signalled, unless --preserve-status is given.
+const exitTimedOut = 124
+
+type options struct {
+	sig            syscall.Signal
+	killAfter      time.Duration
+	preserveStatus bool
+	foreground     bool
+}
+
 // Run executes the timeout command with the given arguments.
 //
+// Usage:
+//
+//	timeout [OPTIONS] DURATION COMMAND [ARG]...
+//
 // Supported flags:
 //
-//	-s SIGNAL   Specify the signal to send on timeout (default SIGTERM)
-//	-k DUR      Send SIGKILL after DUR if the process is still running
-//	            (accepted for compatibility, not fully implemented)
+//	-s, --signal SIGNAL     Signal to send on timeout (name or number; default TERM)
+//	-k, --kill-after DUR    Send KILL if the command is still running DUR
+//	                        after the first signal
+//	--preserve-status       Exit with the command's status even on timeout
+//	--foreground            Leave the command in timeout's process group and
+//	                        signal only the command itself
 //
 // Duration supports optional suffixes: s (seconds, default), m (minutes),
-// h (hours), d (days). Exit code is 143 when the process is killed by
-// SIGTERM.
+// h (hours), d (days). When the command times out the exit status is 124,
+// or 137 if it had to be killed with KILL. Without --foreground the
+// command runs in its own process group and the whole group is signalled.
+// SIGINT, SIGTERM, SIGHUP and SIGQUIT sent to timeout are passed on.
 func Run(stdio *core.Stdio, args []string) int {
-	sig := syscall.SIGTERM
+	opts := options{sig: syscall.SIGTERM}
 	if len(args) == 0 {
 		return core.UsageError(stdio, "timeout", "missing duration or command")
 	}
 	i := 0
-	for i < len(args) && strings.HasPrefix(args[i], "-") {
-		switch args[i] {
-		case "-s":
+	for ; i < len(args) && strings.HasPrefix(args[i], "-") && args[i] != "-"; i++ {
+		arg := args[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		name, value, hasValue := arg, "", false
+		switch {
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue = strings.Cut(arg, "=")
+		case len(arg) > 2:
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+		switch name {
+		case "--preserve-status":
+			opts.preserveStatus = true
+			continue
+		case "--foreground":
+			opts.foreground = true
+			continue
+		case "-s", "--signal", "-k", "--kill-after":
+		default:
+			return core.UsageError(stdio, "timeout", "invalid option -- '"+strings.TrimLeft(name, "-")+"'")
+		}
+		if !hasValue {
 			if i+1 >= len(args) {
-				return core.UsageError(stdio, "timeout", "missing signal")
+				return core.UsageError(stdio, "timeout", "option requires an argument -- '"+strings.TrimLeft(name, "-")+"'")
 			}
-			parsed, err := procutil.ParseSignal(args[i+1])
+			i++
+			value = args[i]
+		}
+		if name == "-s" || name == "--signal" {
+			parsed, err := procutil.ParseSignal(value)
 			if err != nil {
-				return core.UsageError(stdio, "timeout", "invalid signal")
+				return core.UsageError(stdio, "timeout", "'"+value+"': invalid signal")
 			}
-			sig = parsed
-			i += 2
-		case "-k":
-			if i+1 >= len(args) {
-				return core.UsageError(stdio, "timeout", "missing duration")
+			opts.sig = parsed
+		} else {
+			spec, err := timeutil.ParseDuration(value)
+			if err != nil || spec.Duration < 0 {
+				return core.UsageError(stdio, "timeout", "invalid time interval '"+value+"'")
 			}
-			i += 2
-		default:
-			return core.UsageError(stdio, "timeout", "invalid option -- '"+strings.TrimPrefix(args[i], "-")+"'")
+			opts.killAfter = spec.Duration
 		}
 	}
 	if len(args)-i < 2 {
 		return core.UsageError(stdio, "timeout", "missing duration or command")
 	}
 	spec, err := timeutil.ParseDuration(args[i])
-	if err != nil {
+	if err != nil || spec.Duration < 0 {
 		return core.UsageError(stdio, "timeout", "invalid duration")
 	}
 	cmd := exec.Command(args[i+1], args[i+2:]...) // #nosec G204 -- timeout runs user-provided command
@@ -65,27 +111,84 @@ func Run(stdio *core.Stdio, args []string) int {
 	cmd.Stderr = stdio.Err
 	cmd.Stdin = stdio.In
 	cmd.Env = os.Environ()
+	if !opts.foreground {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
 	if err := cmd.Start(); err != nil {
 		stdio.Errorf("timeout: %v\n", err)
 		return core.ExitFailure
 	}
+	return supervise(stdio, cmd, spec.Duration, opts)
+}
+
+// supervise waits for cmd, signalling it when the duration expires and
+// escalating to KILL after opts.killAfter.
+func supervise(stdio *core.Stdio, cmd *exec.Cmd, d time.Duration, opts options) int {
 	done := make(chan error, 1)
 	go func() { done <- cmd.Wait() }()
-	select {
-	case err := <-done:
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				return exitErr.ExitCode()
+
+	relay := make(chan os.Signal, 1)
+	signal.Notify(relay, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(relay)
+
+	send := func(sig syscall.Signal) {
+		if opts.foreground {
+			_ = cmd.Process.Signal(sig)
+			return
+		}
+		_ = syscall.Kill(-cmd.Process.Pid, sig)
+	}
+
+	expired := time.NewTimer(d)
+	defer expired.Stop()
+	var kill <-chan time.Time
+	timedOut, killed := false, false
+	for {
+		select {
+		case err := <-done:
+			status := exitStatus(stdio, err)
+			switch {
+			case !timedOut || opts.preserveStatus:
+				return status
+			case killed:
+				return 128 + int(syscall.SIGKILL)
+			}
+			return exitTimedOut
+		case sig := <-relay:
+			send(sig.(syscall.Signal))
+		case <-expired.C:
+			timedOut = true
+			send(opts.sig)
+			killed = opts.sig == syscall.SIGKILL
+			if !killed {
+				// A stopped command cannot act on the signal until it
+				// is continued.
+				send(syscall.SIGCONT)
+				if opts.killAfter > 0 {
+					kill = time.After(opts.killAfter)
+				}
 			}
-			stdio.Errorf("timeout: %v\n", err)
-			return core.ExitFailure
+		case <-kill:
+			send(syscall.SIGKILL)
+			killed = true
+			kill = nil
 		}
+	}
+}
+
+// exitStatus converts the result of Wait into a shell-style status:
+// the exit code, or 128 plus the signal that ended the command.
+func exitStatus(stdio *core.Stdio, err error) int {
+	if err == nil {
 		return core.ExitSuccess
-	case <-time.After(spec.Duration):
-		_ = cmd.Process.Signal(sig)
-		if sig == syscall.SIGTERM {
-			return 143
-		}
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		stdio.Errorf("timeout: %v\n", err)
 		return core.ExitFailure
 	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return exitErr.ExitCode()
 }
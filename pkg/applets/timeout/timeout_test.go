@@ -2,6 +2,7 @@ package timeout_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/timeout"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -25,6 +26,69 @@ func TestTimeout(t *testing.T) {
 			Args:     []string{"1", "echo", "ok"},
 			WantCode: core.ExitSuccess,
 		},
+		{
+			Name:     "expired",
+			Args:     []string{"0.1", "sleep", "5"},
+			WantCode: 124,
+		},
+		{
+			Name:     "child_status",
+			Args:     []string{"5", "sh", "-c", "exit 7"},
+			WantCode: 7,
+		},
+		{
+			Name:     "signal_by_name",
+			Args:     []string{"-s", "KILL", "0.1", "sleep", "5"},
+			WantCode: 137,
+		},
+		{
+			Name:     "preserve_status",
+			Args:     []string{"--signal=INT", "--preserve-status", "0.1", "sleep", "5"},
+			WantCode: 130,
+		},
+		{
+			Name:     "preserve_status_handler",
+			Args:     []string{"--preserve-status", "0.1", "sh", "-c", "trap 'exit 3' TERM; while :; do sleep 0.05; done"},
+			WantCode: 3,
+		},
+		{
+			Name:     "foreground",
+			Args:     []string{"--foreground", "-s15", "0.1", "sleep", "5"},
+			WantCode: 124,
+		},
+		{
+			Name:     "invalid_signal",
+			Args:     []string{"-s", "BOGUS", "1", "true"},
+			WantCode: core.ExitUsage,
+			WantErr:  "'BOGUS': invalid signal",
+		},
+		{
+			Name:     "invalid_kill_after",
+			Args:     []string{"--kill-after=soon", "1", "true"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid time interval 'soon'",
+		},
 	}
 	testutil.RunAppletTests(t, timeout.Run, tests)
 }
+
+func TestTimeoutKillAfter(t *testing.T) {
+	// The shell and the sleep it starts both ignore TERM, so only the
+	// KILL sent by -k ends them.
+	start := time.Now()
+	_, _, code := testutil.CaptureAndRun(t, timeout.Run,
+		[]string{"-k", "0.2", "0.1", "sh", "-c", "trap '' TERM; sleep 5; exit 9"}, "")
+	testutil.AssertExitCode(t, code, 137)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("KILL escalation took %v", elapsed)
+	}
+
+	// Without -k the same command outlives the timeout.
+	start = time.Now()
+	_, _, code = testutil.CaptureAndRun(t, timeout.Run,
+		[]string{"0.1", "sh", "-c", "trap '' TERM; sleep 0.5; exit 9"}, "")
+	testutil.AssertExitCode(t, code, 124)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("command ignoring TERM ended after %v", elapsed)
+	}
+}
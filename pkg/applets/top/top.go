@@ -1,16 +1,617 @@
 //go:build !js && !wasm && !wasip1
 
-// Package top implements a minimal top command.
+// Package top implements the top command.
 package top
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rcarmo/go-busybox/pkg/applets/procutil"
 	"github.com/rcarmo/go-busybox/pkg/core"
+	"golang.org/x/term"
+)
+
+// procRoot is where process and system statistics are read from.
+const procRoot = "/proc"
+
+// primeDelay is how long the first frame samples CPU usage over, so
+// that a single snapshot does not show every process at 0%.
+const primeDelay = 100 * time.Millisecond
+
+type sortField int
+
+const (
+	sortCPU sortField = iota
+	sortMem
+	sortPID
+	sortTime
 )
 
-// Run executes the top command. This is a minimal stub that prints
-// a static process listing header. No flags are supported.
+type options struct {
+	batch      bool
+	iterations int // 0 means run until interrupted
+	delay      time.Duration
+	sortBy     sortField
+	reverse    bool
+}
+
+// cpuTimes holds the aggregate jiffies from the cpu line of /proc/stat.
+type cpuTimes struct {
+	user, nice, system, idle, iowait, irq, softirq, steal uint64
+}
+
+func (c cpuTimes) total() uint64 {
+	return c.user + c.nice + c.system + c.idle + c.iowait + c.irq + c.softirq + c.steal
+}
+
+// sample is one reading of the system and process CPU counters.
+type sample struct {
+	cpu   cpuTimes
+	usage cpuTimes       // cpu minus the previous sample's counters
+	ticks map[int]uint64 // pid -> utime+stime
+	procs []procRow
+}
+
+type procRow struct {
+	pid   int
+	ppid  int
+	uid   string
+	user  string
+	state string
+	vszKB int
+	rssKB int
+	ticks uint64
+	pcpu  float64
+	pmem  float64
+	cmd   string
+}
+
+// Run executes the top command with the given arguments.
+//
+// Supported flags:
+//
+//	-b        Batch mode: plain output, one frame after another
+//	-n N      Exit after N frames
+//	-d SECS   Delay between frames (fractional seconds allowed)
+//
+// Interactive keys:
+//
+//	P    Sort by %CPU (default)
+//	M    Sort by memory
+//	N    Sort by PID
+//	T    Sort by CPU time
+//	R    Reverse the sort order
+//	k    Prompt for a PID and a signal to send it
+//	q    Quit
+//
+// Each frame shows memory, CPU and load summaries followed by the
+// process table; interactively, the sort column is highlighted. Batch
+// frames carry no escape sequences and end with a blank line, so they
+// can be appended to a log. When stdout is not a terminal, batch mode is
+// implied and, without -n, a single frame is printed.
 func Run(stdio *core.Stdio, args []string) int {
-	stdio.Println("PID USER COMMAND")
-	stdio.Println("0 root [top]")
+	opts := options{delay: 3 * time.Second}
+	explicitN := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			return core.UsageError(stdio, "top", "invalid argument '"+arg+"'")
+		}
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			switch c {
+			case 'b':
+				opts.batch = true
+				continue
+			case 'n', 'd':
+			default:
+				return core.UsageError(stdio, "top", "invalid option -- '"+string(c)+"'")
+			}
+			value := arg[j+1:]
+			if value == "" {
+				if i+1 >= len(args) {
+					return core.UsageError(stdio, "top", "option requires an argument -- '"+string(c)+"'")
+				}
+				i++
+				value = args[i]
+			}
+			if c == 'n' {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 {
+					return core.UsageError(stdio, "top", "invalid number '"+value+"'")
+				}
+				opts.iterations = n
+				explicitN = true
+			} else {
+				secs, err := strconv.ParseFloat(value, 64)
+				if err != nil || secs < 0 {
+					return core.UsageError(stdio, "top", "invalid delay '"+value+"'")
+				}
+				opts.delay = time.Duration(secs * float64(time.Second))
+			}
+			break
+		}
+	}
+
+	out, ok := stdio.Out.(*os.File)
+	if opts.batch || !ok || !term.IsTerminal(int(out.Fd())) {
+		if !explicitN {
+			opts.iterations = 1
+		}
+		return runBatch(stdio, opts)
+	}
+	return runInteractive(stdio, out, opts)
+}
+
+func runBatch(stdio *core.Stdio, opts options) int {
+	prev := takeSample()
+	time.Sleep(primeDelay)
+	for frame := 0; opts.iterations == 0 || frame < opts.iterations; frame++ {
+		if frame > 0 {
+			time.Sleep(opts.delay)
+		}
+		cur := takeSample()
+		computeUsage(prev, &cur)
+		sortRows(cur.procs, opts.sortBy, opts.reverse)
+		for _, line := range renderFrame(cur, opts) {
+			stdio.Println(line)
+		}
+		stdio.Println()
+		prev = cur
+	}
 	return core.ExitSuccess
 }
+
+// runInteractive redraws the screen every opts.delay and reacts to
+// single-key commands read from stdin. The terminal is put in raw mode
+// for the duration and restored on return or on SIGINT, SIGTERM and
+// SIGHUP; only SIGKILL can leave it raw.
+func runInteractive(stdio *core.Stdio, out *os.File, opts options) int {
+	restore := func() { stdio.Print("\033[?25h\r\n") }
+	if in, ok := stdio.In.(*os.File); ok && term.IsTerminal(int(in.Fd())) {
+		if state, err := term.MakeRaw(int(in.Fd())); err == nil {
+			restore = func() {
+				stdio.Print("\033[?25h\r\n")
+				_ = term.Restore(int(in.Fd()), state)
+			}
+		}
+	}
+	defer restore()
+	done := make(chan struct{})
+	defer close(done)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case sig := <-sigs:
+			restore()
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-done:
+		}
+	}()
+	keys := make(chan byte, 64)
+	go readKeys(stdio.In, keys)
+
+	prev := takeSample()
+	time.Sleep(primeDelay)
+	cur := takeSample()
+	computeUsage(prev, &cur)
+	message := ""
+	stdio.Print("\033[?25l\033[H\033[2J")
+	for frame := 1; ; {
+		width, height := terminalSize(out)
+		sortRows(cur.procs, opts.sortBy, opts.reverse)
+		drawScreen(stdio, renderFrame(cur, opts), width, height, sortLabels[opts.sortBy], message)
+		message = ""
+		if opts.iterations > 0 && frame >= opts.iterations {
+			return core.ExitSuccess
+		}
+		timer := time.NewTimer(opts.delay)
+		redraw := false
+		for !redraw {
+			select {
+			case <-timer.C:
+				next := takeSample()
+				computeUsage(cur, &next)
+				cur = next
+				frame++
+				redraw = true
+			case key, ok := <-keys:
+				if !ok {
+					keys = nil
+					continue
+				}
+				switch key {
+				case 'P':
+					opts.sortBy = sortCPU
+				case 'M':
+					opts.sortBy = sortMem
+				case 'N':
+					opts.sortBy = sortPID
+				case 'T':
+					opts.sortBy = sortTime
+				case 'R':
+					opts.reverse = !opts.reverse
+				case 'k':
+					message = promptKill(stdio, keys)
+				case 'q', 3: // 3 is ^C, which raw mode delivers as a key
+					timer.Stop()
+					return core.ExitSuccess
+				default:
+					continue
+				}
+				redraw = true
+			}
+		}
+		timer.Stop()
+	}
+}
+
+// sortLabels names the header column highlighted for each sort order.
+var sortLabels = map[sortField]string{
+	sortCPU:  "%CPU",
+	sortMem:  "%MEM",
+	sortPID:  "PID",
+	sortTime: "TIME",
+}
+
+// readKeys forwards bytes from r until it fails or reaches EOF.
+func readKeys(r io.Reader, keys chan<- byte) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			keys <- b
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// promptKill asks for a PID and a signal on the bottom line and sends
+// the signal. It returns the message to show with the next frame.
+func promptKill(stdio *core.Stdio, keys <-chan byte) string {
+	pidText, ok := readLine(stdio, keys, "PID to signal/kill: ")
+	if !ok || strings.TrimSpace(pidText) == "" {
+		return ""
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(pidText))
+	if err != nil || pid <= 0 {
+		return "Bad PID '" + pidText + "'"
+	}
+	sigText, ok := readLine(stdio, keys, fmt.Sprintf("Signal to send to PID %d [15]: ", pid))
+	if !ok {
+		return ""
+	}
+	sig := syscall.SIGTERM
+	if strings.TrimSpace(sigText) != "" {
+		sig, err = procutil.ParseSignal(strings.TrimSpace(sigText))
+		if err != nil {
+			return "Bad signal '" + sigText + "'"
+		}
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Sprintf("kill %d: %v", pid, err)
+	}
+	return ""
+}
+
+// readLine shows prompt on the bottom line and echoes typed characters
+// until Enter. Escape cancels.
+func readLine(stdio *core.Stdio, keys <-chan byte, prompt string) (string, bool) {
+	stdio.Print("\r\033[K" + prompt + "\033[?25h")
+	defer stdio.Print("\033[?25l")
+	var line []byte
+	for key := range keys {
+		switch {
+		case key == '\r' || key == '\n':
+			return string(line), true
+		case key == 27 || key == 3:
+			return "", false
+		case key == 127 || key == 8:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				stdio.Print("\b \b")
+			}
+		case key >= ' ' && key < 127:
+			line = append(line, key)
+			stdio.Print(string(key))
+		}
+	}
+	return "", false
+}
+
+func terminalSize(out *os.File) (int, int) {
+	width, height, err := term.GetSize(int(out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// drawScreen redraws the terminal in place rather than clearing it, so
+// the display does not flicker: the cursor is homed, every line is cut
+// to the width and cleared to its end, and whatever is left below is
+// erased. The last row holds message. The header column named by
+// highlight is shown in reverse video.
+func drawScreen(stdio *core.Stdio, lines []string, width, height int, highlight, message string) {
+	if len(lines) > height-1 {
+		lines = lines[:height-1]
+	}
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range lines {
+		line = truncate(line, width)
+		if i == tableHeaderLine {
+			if at := strings.Index(line, highlight); at >= 0 && highlight != "" {
+				line = line[:at] + "\033[7m" + highlight + "\033[m" + line[at+len(highlight):]
+			}
+		}
+		b.WriteString(line)
+		b.WriteString("\033[K\r\n")
+	}
+	b.WriteString(truncate(message, width))
+	b.WriteString("\033[J")
+	stdio.Print(b.String())
+}
+
+func truncate(line string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width])
+}
+
+// tableHeaderLine is the index of the column header in renderFrame's
+// output.
+const tableHeaderLine = 3
+
+// renderFrame formats the summary block and the process table.
+func renderFrame(s sample, opts options) []string {
+	mem := readMeminfo()
+	lines := []string{
+		fmt.Sprintf("Mem: %dK used, %dK free, %dK shrd, %dK buff, %dK cached",
+			mem["MemTotal"]-mem["MemFree"], mem["MemFree"], mem["Shmem"], mem["Buffers"], mem["Cached"]),
+		formatCPULine(s.usage),
+		"Load average: " + readLoadavg(),
+		fmt.Sprintf("%5s %5s %-8s %-4s %5s %5s %4s %4s %8s %s",
+			"PID", "PPID", "USER", "STAT", "VSZ", "RSS", "%MEM", "%CPU", "TIME", "COMMAND"),
+	}
+	for _, p := range s.procs {
+		lines = append(lines, fmt.Sprintf("%5d %5d %-8.8s %-4.4s %5s %5s %4.1f %4.1f %8s %s",
+			p.pid, p.ppid, p.user, p.state, formatKB(p.vszKB), formatKB(p.rssKB),
+			p.pmem, p.pcpu, formatTicks(p.ticks), p.cmd))
+	}
+	return lines
+}
+
+// formatCPULine shows the share of CPU time spent in each state. cpu
+// holds the difference between two samples.
+func formatCPULine(cpu cpuTimes) string {
+	total := float64(cpu.total())
+	if total == 0 {
+		total = 1
+	}
+	pct := func(v uint64) float64 { return 100 * float64(v) / total }
+	return fmt.Sprintf("CPU: %4.1f%% usr %4.1f%% sys %4.1f%% nic %4.1f%% idle %4.1f%% io %4.1f%% irq %4.1f%% sirq",
+		pct(cpu.user), pct(cpu.system), pct(cpu.nice), pct(cpu.idle), pct(cpu.iowait), pct(cpu.irq), pct(cpu.softirq))
+}
+
+// formatKB abbreviates large sizes with m and g suffixes, as busybox top
+// does, so they fit a five-character column.
+func formatKB(kb int) string {
+	switch {
+	case kb >= 100000*1024:
+		return strconv.Itoa(kb/(1024*1024)) + "g"
+	case kb >= 100000:
+		return strconv.Itoa(kb/1024) + "m"
+	}
+	return strconv.Itoa(kb)
+}
+
+// formatTicks renders cumulative CPU time as M:SS.hh.
+func formatTicks(ticks uint64) string {
+	hundredths := ticks * 100 / clockTicks
+	secs := hundredths / 100
+	return fmt.Sprintf("%d:%02d.%02d", secs/60, secs%60, hundredths%100)
+}
+
+// clockTicks is USER_HZ, the unit of the times in /proc/PID/stat.
+const clockTicks = 100
+
+// computeUsage turns the counters in cur into percentages using prev as
+// the baseline and records the per-state CPU deltas in cur.usage.
+func computeUsage(prev sample, cur *sample) {
+	delta := cpuTimes{
+		user:    cur.cpu.user - prev.cpu.user,
+		nice:    cur.cpu.nice - prev.cpu.nice,
+		system:  cur.cpu.system - prev.cpu.system,
+		idle:    cur.cpu.idle - prev.cpu.idle,
+		iowait:  cur.cpu.iowait - prev.cpu.iowait,
+		irq:     cur.cpu.irq - prev.cpu.irq,
+		softirq: cur.cpu.softirq - prev.cpu.softirq,
+		steal:   cur.cpu.steal - prev.cpu.steal,
+	}
+	elapsed := float64(delta.total())
+	memKB := float64(readMeminfo()["MemTotal"])
+	for i := range cur.procs {
+		p := &cur.procs[i]
+		if before, ok := prev.ticks[p.pid]; ok && elapsed > 0 && p.ticks >= before {
+			p.pcpu = 100 * float64(p.ticks-before) / elapsed
+		}
+		if memKB > 0 {
+			p.pmem = 100 * float64(p.rssKB) / memKB
+		}
+	}
+	cur.usage = delta
+}
+
+// sortRows orders the table. Ties keep PID order so rows do not jump
+// around between frames.
+func sortRows(rows []procRow, by sortField, reverse bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		var less, greater bool
+		switch by {
+		case sortMem:
+			less, greater = a.rssKB > b.rssKB, a.rssKB < b.rssKB
+		case sortPID:
+			less, greater = a.pid < b.pid, a.pid > b.pid
+		case sortTime:
+			less, greater = a.ticks > b.ticks, a.ticks < b.ticks
+		default:
+			less, greater = a.pcpu > b.pcpu, a.pcpu < b.pcpu
+		}
+		if reverse {
+			less = greater
+		}
+		return less
+	})
+}
+
+func takeSample() sample {
+	s := sample{cpu: readCPUTimes(), ticks: map[int]uint64{}}
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return s
+	}
+	users := map[string]string{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		row, ok := readProc(pid)
+		if !ok {
+			continue
+		}
+		name, seen := users[row.uid]
+		if !seen {
+			name = procutil.LookupUser(row.uid)
+			users[row.uid] = name
+		}
+		row.user = name
+		s.ticks[pid] = row.ticks
+		s.procs = append(s.procs, row)
+	}
+	sort.Slice(s.procs, func(i, j int) bool { return s.procs[i].pid < s.procs[j].pid })
+	return s
+}
+
+func readProc(pid int) (procRow, bool) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	data, err := os.ReadFile(filepath.Join(dir, "stat")) // #nosec G304 -- /proc read
+	if err != nil {
+		return procRow{}, false
+	}
+	stat := strings.TrimSpace(string(data))
+	open, closeIdx := strings.IndexByte(stat, '('), strings.LastIndex(stat, ") ")
+	if open < 0 || closeIdx < open {
+		return procRow{}, false
+	}
+	rest := strings.Fields(stat[closeIdx+2:])
+	if len(rest) < 22 {
+		return procRow{}, false
+	}
+	row := procRow{pid: pid, state: rest[0]}
+	row.ppid, _ = strconv.Atoi(rest[1])
+	utime, _ := strconv.ParseUint(rest[11], 10, 64)
+	stime, _ := strconv.ParseUint(rest[12], 10, 64)
+	row.ticks = utime + stime
+	if nice, _ := strconv.Atoi(rest[16]); nice < 0 {
+		row.state += "<"
+	} else if nice > 0 {
+		row.state += "N"
+	}
+	vsize, _ := strconv.Atoi(rest[20])
+	rss, _ := strconv.Atoi(rest[21])
+	row.vszKB = vsize / 1024
+	row.rssKB = rss * os.Getpagesize() / 1024
+
+	if status, err := os.ReadFile(filepath.Join(dir, "status")); err == nil { // #nosec G304 -- /proc read
+		for _, line := range strings.Split(string(status), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+				row.uid = fields[1]
+				break
+			}
+		}
+	}
+	row.cmd = readCmdline(dir)
+	if row.cmd == "" {
+		row.cmd = "[" + stat[open+1:closeIdx] + "]"
+	}
+	return row, true
+}
+
+func readCmdline(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "cmdline")) // #nosec G304 -- /proc read
+	if err != nil {
+		return ""
+	}
+	data = []byte(strings.TrimRight(string(data), "\x00"))
+	for i, c := range data {
+		if c < ' ' {
+			data[i] = ' '
+		}
+	}
+	return string(data)
+}
+
+func readCPUTimes() cpuTimes {
+	data, err := os.ReadFile(filepath.Join(procRoot, "stat")) // #nosec G304 -- /proc read
+	if err != nil {
+		return cpuTimes{}
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}
+	}
+	vals := make([]uint64, 8)
+	for i := range vals {
+		if i+1 < len(fields) {
+			vals[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+		}
+	}
+	return cpuTimes{vals[0], vals[1], vals[2], vals[3], vals[4], vals[5], vals[6], vals[7]}
+}
+
+// readMeminfo returns the /proc/meminfo values in kB, keyed by name.
+func readMeminfo() map[string]int {
+	info := map[string]int{}
+	data, err := os.ReadFile(filepath.Join(procRoot, "meminfo")) // #nosec G304 -- /proc read
+	if err != nil {
+		return info
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			n, _ := strconv.Atoi(fields[1])
+			info[strings.TrimSuffix(fields[0], ":")] = n
+		}
+	}
+	return info
+}
+
+// readLoadavg returns /proc/loadavg as busybox top shows it: the three
+// averages, running/total tasks and the last PID.
+func readLoadavg() string {
+	data, err := os.ReadFile(filepath.Join(procRoot, "loadavg")) // #nosec G304 -- /proc read
+	if err != nil {
+		return "0.00 0.00 0.00"
+	}
+	return strings.Join(strings.Fields(string(data)), " ")
+}
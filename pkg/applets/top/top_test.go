@@ -1,11 +1,19 @@
 package top_test
 
 import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/top"
 	"github.com/rcarmo/go-busybox/pkg/core"
 	"github.com/rcarmo/go-busybox/pkg/testutil"
+	"golang.org/x/term"
 )
 
 func TestTop(t *testing.T) {
@@ -16,6 +24,153 @@ func TestTop(t *testing.T) {
 			WantCode:   core.ExitSuccess,
 			WantOutSub: "PID",
 		},
+		{
+			Name:     "bad_delay",
+			Args:     []string{"-d", "x"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid delay",
+		},
+		{
+			Name:     "bad_count",
+			Args:     []string{"-n0"},
+			WantCode: core.ExitUsage,
+			WantErr:  "invalid number",
+		},
+		{
+			Name:     "missing_count",
+			Args:     []string{"-b", "-n"},
+			WantCode: core.ExitUsage,
+			WantErr:  "requires an argument",
+		},
 	}
 	testutil.RunAppletTests(t, top.Run, tests)
 }
+
+func TestTopBatch(t *testing.T) {
+	out, _, code := testutil.CaptureAndRun(t, top.Run, []string{"-b", "-n", "1"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	frame := out.String()
+	for _, want := range []string{"Mem: ", "CPU: ", "Load average: ", "  PID  PPID USER"} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("frame missing %q:\n%s", want, frame)
+		}
+	}
+	if strings.Contains(frame, "\x1b") {
+		t.Errorf("batch output contains escape sequences:\n%q", frame)
+	}
+	if !strings.HasSuffix(frame, "\n\n") {
+		t.Errorf("batch frame should end with a blank line")
+	}
+
+	out, _, code = testutil.CaptureAndRun(t, top.Run, []string{"-bn2", "-d0.01"}, "")
+	testutil.AssertExitCode(t, code, core.ExitSuccess)
+	if n := strings.Count(out.String(), "\nLoad average: "); n != 2 {
+		t.Errorf("got %d frames, want 2", n)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if !strings.HasPrefix(line, "CPU:") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(field, "%"), 64)
+			if err == nil && (pct < 0 || pct > 100) {
+				t.Errorf("CPU share out of range: %q", line)
+			}
+		}
+	}
+}
+
+// screen collects everything top writes to the pseudo-terminal.
+type screen struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *screen) waitFor(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		found := strings.Contains(s.buf.String(), want)
+		s.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %q", want)
+}
+
+func TestTopInteractive(t *testing.T) {
+	master, slave := testutil.OpenPTY(t)
+	before, err := term.GetState(int(slave.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out screen
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			_, _ = out.Write(buf[:n])
+			if err != nil {
+				return
+			}
+		}
+	}()
+	child := exec.Command("sleep", "30")
+	if err := child.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- child.Wait() }()
+	defer func() { _ = child.Process.Kill() }()
+
+	var errBuf bytes.Buffer
+	code := make(chan int, 1)
+	go func() {
+		code <- top.Run(&core.Stdio{In: slave, Out: slave, Err: &errBuf}, []string{"-d", "30"})
+	}()
+
+	out.waitFor(t, "\x1b[7m%CPU\x1b[m")
+	if _, err := master.Write([]byte("M")); err != nil {
+		t.Fatal(err)
+	}
+	out.waitFor(t, "\x1b[7m%MEM\x1b[m")
+	if _, err := master.Write([]byte("k" + strconv.Itoa(child.Process.Pid) + "\r9\r")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-exited:
+		if err == nil || !strings.Contains(err.Error(), "killed") {
+			t.Errorf("sleep exited with %v, want killed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("k did not signal the process")
+	}
+	if _, err := master.Write([]byte("q")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-code:
+		testutil.AssertExitCode(t, c, core.ExitSuccess)
+	case <-time.After(5 * time.Second):
+		t.Fatal("q did not quit")
+	}
+	after, err := term.GetState(int(slave.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("terminal mode not restored")
+	}
+	if errBuf.Len() > 0 {
+		t.Errorf("unexpected stderr: %s", errBuf.String())
+	}
+}
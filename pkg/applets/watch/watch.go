@@ -4,56 +4,406 @@
 package watch
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
+	"golang.org/x/term"
 )
 
+// minInterval is the shortest refresh period, as in procps watch.
+const minInterval = 100 * time.Millisecond
+
+// exitErrexit is the status procps watch uses when -e stops it.
+const exitErrexit = 8
+
+type options struct {
+	interval    time.Duration
+	differences bool
+	chgexit     bool
+	noTitle     bool
+	errexit     bool
+	beep        bool
+	precise     bool
+	exec        bool
+}
+
 // Run executes the watch command with the given arguments.
 //
 // Supported flags:
 //
-//	-n SEC    Specify update interval in seconds (default 2)
+//	-n, --interval SEC   Update interval in seconds, fractions allowed (default 2)
+//	-d, --differences    Highlight characters that changed since the last run
+//	-g, --chgexit        Exit when the output of COMMAND changes
+//	-t, --no-title       Do not print the header line
+//	-e, --errexit        Freeze on a non-zero exit and exit after a keypress
+//	-b, --beep           Beep when COMMAND exits non-zero
+//	-p, --precise        Start runs on fixed interval boundaries
+//	-x, --exec           Run COMMAND directly instead of through sh -c
 //
-// Executes COMMAND repeatedly (currently runs once due to non-interactive
-// implementation).
+// COMMAND and its arguments are joined and run with sh -c unless -x is
+// given; stdout and stderr are both shown. With -p the interval is
+// measured from the start of one run to the start of the next, and
+// boundaries missed by a slow run are skipped rather than caught up. On a terminal the screen is redrawn in place
+// until interrupted. When stdout is not a terminal, frames are printed
+// one after another without escape sequences, and unless -g or -e gives
+// watch a reason to stop, COMMAND runs only once and its exit status is
+// returned.
 func Run(stdio *core.Stdio, args []string) int {
-	interval := 2 * time.Second
-	if len(args) == 0 {
-		return core.UsageError(stdio, "watch", "missing command")
-	}
-	if args[0] == "-n" {
-		if len(args) < 3 {
-			return core.UsageError(stdio, "watch", "missing interval")
+	opts := options{interval: 2 * time.Second}
+	i := 0
+	for ; i < len(args) && strings.HasPrefix(args[i], "-") && args[i] != "-"; i++ {
+		arg := args[i]
+		if arg == "--" {
+			i++
+			break
 		}
-		value, err := time.ParseDuration(args[1] + "s")
-		if err != nil {
-			return core.UsageError(stdio, "watch", "invalid interval")
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg, "=")
+			switch name {
+			case "--interval":
+				if !hasValue {
+					if i+1 >= len(args) {
+						return core.UsageError(stdio, "watch", "missing interval")
+					}
+					i++
+					value = args[i]
+				}
+				if code := opts.setInterval(stdio, value); code != core.ExitSuccess {
+					return code
+				}
+			case "--differences":
+				opts.differences = true
+			case "--chgexit":
+				opts.chgexit = true
+			case "--no-title":
+				opts.noTitle = true
+			case "--errexit":
+				opts.errexit = true
+			case "--beep":
+				opts.beep = true
+			case "--precise":
+				opts.precise = true
+			case "--exec":
+				opts.exec = true
+			default:
+				return core.UsageError(stdio, "watch", "unrecognized option '"+arg+"'")
+			}
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			switch arg[j] {
+			case 'd':
+				opts.differences = true
+			case 'g':
+				opts.chgexit = true
+			case 't':
+				opts.noTitle = true
+			case 'e':
+				opts.errexit = true
+			case 'b':
+				opts.beep = true
+			case 'p':
+				opts.precise = true
+			case 'x':
+				opts.exec = true
+			case 'n':
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return core.UsageError(stdio, "watch", "missing interval")
+					}
+					i++
+					value = args[i]
+				}
+				if code := opts.setInterval(stdio, value); code != core.ExitSuccess {
+					return code
+				}
+				j = len(arg)
+			default:
+				return core.UsageError(stdio, "watch", "invalid option -- '"+string(arg[j])+"'")
+			}
 		}
-		interval = value
-		args = args[2:]
 	}
+	args = args[i:]
 	if len(args) == 0 {
 		return core.UsageError(stdio, "watch", "missing command")
 	}
-	cmdStr := strings.Join(args, " ")
-	cmd := exec.Command("sh", "-c", cmdStr) // #nosec G204 -- watch executes user-provided shell command
-	cmd.Stdout = stdio.Out
-	cmd.Stderr = stdio.Err
-	cmd.Stdin = stdio.In
-	cmd.Env = os.Environ()
-	if err := cmd.Run(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return exitErr.ExitCode()
+	command := strings.Join(args, " ")
+	if !opts.exec {
+		args = []string{"sh", "-c", command}
+	}
+
+	out, ok := stdio.Out.(*os.File)
+	if !ok || !term.IsTerminal(int(out.Fd())) {
+		out = nil
+		if !opts.chgexit && !opts.errexit {
+			output, status := runCommand(args)
+			printPlain(stdio, header(opts, command, 80), output)
+			if opts.beep && status != 0 {
+				stdio.Print("\a")
+			}
+			return status
 		}
-		stdio.Errorf("watch: %v\n", err)
-		return core.ExitFailure
 	}
-	if interval > 0 {
-		time.Sleep(interval)
+	return loop(stdio, out, args, command, opts)
+}
+
+func (o *options) setInterval(stdio *core.Stdio, value string) int {
+	secs, err := strconv.ParseFloat(value, 64)
+	if err != nil || secs < 0 || math.IsNaN(secs) {
+		return core.UsageError(stdio, "watch", "invalid interval '"+value+"'")
+	}
+	o.interval = time.Duration(secs * float64(time.Second))
+	if o.interval < minInterval {
+		o.interval = minInterval
 	}
 	return core.ExitSuccess
 }
+
+// loop runs command every interval until interrupted or until -g or -e
+// ends it. tty is nil when stdout is not a terminal.
+func loop(stdio *core.Stdio, tty *os.File, args []string, command string, opts options) int {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(interrupt)
+	if tty != nil {
+		stdio.Print("\033[?25l\033[H\033[2J")
+		defer stdio.Print("\033[?25h")
+	}
+
+	var previous []string
+	first := ""
+	next := time.Now()
+	for n := 0; ; n++ {
+		output, status := runCommand(args)
+		width, height := 80, 0
+		if tty != nil {
+			width, height = terminalSize(tty)
+		}
+		title := header(opts, command, width)
+		if tty != nil {
+			lines := screenLines(output, width)
+			drawScreen(stdio, title, lines, previous, height, opts.differences && n > 0)
+			previous = lines
+		} else {
+			if n > 0 {
+				stdio.Println()
+			}
+			printPlain(stdio, title, output)
+		}
+		if opts.beep && status != 0 {
+			stdio.Print("\a")
+		}
+		if n == 0 {
+			first = output
+		} else if opts.chgexit && output != first {
+			return core.ExitSuccess
+		}
+		if opts.errexit && status != 0 {
+			waitForKey(stdio, tty)
+			return exitErrexit
+		}
+		wait := opts.interval
+		if opts.precise {
+			next = next.Add(opts.interval)
+			if late := time.Since(next); late > 0 {
+				next = next.Add((late/opts.interval + 1) * opts.interval)
+			}
+			wait = time.Until(next)
+		}
+		select {
+		case <-time.After(wait):
+		case <-interrupt:
+			return core.ExitSuccess
+		}
+	}
+}
+
+// runCommand runs args and returns its combined stdout and stderr
+// together with its exit status.
+func runCommand(args []string) (string, int) {
+	var buf bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...) // #nosec G204 -- watch executes user-provided command
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	cmd.Env = os.Environ()
+	err := cmd.Run()
+	if err == nil {
+		return buf.String(), core.ExitSuccess
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return buf.String(), exitErr.ExitCode()
+	}
+	status := core.ExitFailure
+	if errors.Is(err, exec.ErrNotFound) {
+		status = 127
+	}
+	return buf.String() + "watch: " + err.Error() + "\n", status
+}
+
+// header is the title line: the interval and command on the left and
+// the host name and time on the right. It is empty with -t.
+func header(opts options, command string, width int) string {
+	if opts.noTitle {
+		return ""
+	}
+	left := fmt.Sprintf("Every %.1fs: %s", opts.interval.Seconds(), command)
+	host, _ := os.Hostname()
+	right := host + ": " + time.Now().Format("Mon Jan _2 15:04:05 2006")
+	pad := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if pad < 1 {
+		// Too narrow for both halves: keep the command and cut it to fit.
+		if runes := []rune(left); len(runes) > width {
+			left = string(runes[:width])
+		}
+		return left
+	}
+	return left + strings.Repeat(" ", pad) + right
+}
+
+func printPlain(stdio *core.Stdio, title, output string) {
+	if title != "" {
+		stdio.Println(title)
+		stdio.Println()
+	}
+	stdio.Print(output)
+}
+
+// screenLines splits output into display lines with tabs expanded,
+// carriage returns dropped and each line cut to width.
+func screenLines(output string, width int) []string {
+	output = strings.TrimSuffix(output, "\n")
+	if output == "" {
+		return nil
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		var b strings.Builder
+		col := 0
+		for _, r := range line {
+			if col >= width {
+				break
+			}
+			switch {
+			case r == '\t':
+				for next := (col/8 + 1) * 8; col < next && col < width; col++ {
+					b.WriteByte(' ')
+				}
+			case r == '\r':
+			case r < ' ':
+				b.WriteByte('?')
+				col++
+			default:
+				b.WriteRune(r)
+				col++
+			}
+		}
+		lines[i] = b.String()
+	}
+	return lines
+}
+
+// drawScreen redraws the terminal in place rather than clearing it, so
+// the display does not flicker. With highlight, characters that differ
+// from the previous frame are shown in reverse video.
+func drawScreen(stdio *core.Stdio, title string, lines, previous []string, height int, highlight bool) {
+	var b strings.Builder
+	b.WriteString("\033[H")
+	rows := 0
+	emit := func(line string) bool {
+		if height > 0 && rows >= height {
+			return false
+		}
+		if rows > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\033[K")
+		rows++
+		return true
+	}
+	if title != "" {
+		emit(title)
+		emit("")
+	}
+	for i, line := range lines {
+		if highlight {
+			old := ""
+			if i < len(previous) {
+				old = previous[i]
+			}
+			line = markChanges(line, old)
+		}
+		if !emit(line) {
+			break
+		}
+	}
+	b.WriteString("\033[J")
+	stdio.Print(b.String())
+}
+
+// markChanges wraps each run of characters in line that differs from
+// the same column of old in reverse video.
+func markChanges(line, old string) string {
+	cur, prev := []rune(line), []rune(old)
+	var b strings.Builder
+	inside := false
+	for i, r := range cur {
+		changed := i >= len(prev) || prev[i] != r
+		if changed != inside {
+			if changed {
+				b.WriteString("\033[7m")
+			} else {
+				b.WriteString("\033[m")
+			}
+			inside = changed
+		}
+		b.WriteRune(r)
+	}
+	if inside {
+		b.WriteString("\033[m")
+	}
+	return b.String()
+}
+
+func terminalSize(f *os.File) (int, int) {
+	width, height, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// waitForKey implements the -e freeze: the failing frame stays on the
+// screen until a key is pressed. A terminal on stdin is switched to raw
+// mode so that any single key will do.
+func waitForKey(stdio *core.Stdio, tty *os.File) {
+	if tty != nil {
+		stdio.Print("\r\n\033[Kcommand exit with a non-zero status, press a key to exit")
+	}
+	if in, ok := stdio.In.(*os.File); ok && term.IsTerminal(int(in.Fd())) {
+		if state, err := term.MakeRaw(int(in.Fd())); err == nil {
+			defer func() { _ = term.Restore(int(in.Fd()), state) }()
+		}
+	}
+	if stdio.In != nil {
+		var key [1]byte
+		_, _ = io.ReadFull(stdio.In, key[:])
+	}
+	if tty != nil {
+		stdio.Print("\r\n")
+	}
+}
@@ -1,13 +1,22 @@
 package watch_test
 
 import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/watch"
 	"github.com/rcarmo/go-busybox/pkg/core"
 	"github.com/rcarmo/go-busybox/pkg/testutil"
 )
 
+// once prints val=0 on its first run and val=1 on every run after it.
+const once = "test -f seen && echo val=1 || { touch seen; echo val=0; }"
+
 func TestWatch(t *testing.T) {
 	tests := []testutil.AppletTestCase{
 		{
@@ -25,6 +34,162 @@ func TestWatch(t *testing.T) {
 			Args:     []string{"echo", "ok"},
 			WantCode: core.ExitSuccess,
 		},
+		{
+			Name:     "no_title",
+			Args:     []string{"-t", "echo", "ok"},
+			WantOut:  "ok\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:       "title",
+			Args:       []string{"-n", "0.5", "echo", "ok"},
+			WantOutSub: "Every 0.5s: echo ok",
+			WantCode:   core.ExitSuccess,
+		},
+		{
+			Name:     "status",
+			Args:     []string{"-t", "sh", "-c", "'echo err >&2; exit 3'"},
+			WantOut:  "err\n",
+			WantCode: 3,
+		},
+		{
+			Name:     "beep",
+			Args:     []string{"-tb", "false"},
+			WantOut:  "\a",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "errexit",
+			Args:     []string{"-t", "-e", "-n0.1", "false"},
+			WantCode: 8,
+		},
+		{
+			Name:     "chgexit",
+			Args:     []string{"-t", "-g", "-n", "0.1", once},
+			WantOut:  "val=0\n\nval=1\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "long_options",
+			Args:     []string{"--no-title", "--chgexit", "--interval=0.1", "--", once},
+			WantOut:  "val=0\n\nval=1\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "exec",
+			Args:     []string{"-t", "-x", "printf", "%s|", "a b", "c"},
+			WantOut:  "a b|c|",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "shell_by_default",
+			Args:     []string{"-t", "echo", "a", "&&", "echo", "b"},
+			WantOut:  "a\nb\n",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:       "exec_not_found",
+			Args:       []string{"-t", "-x", "no-such-command-here"},
+			WantOutSub: "executable file not found",
+			WantCode:   127,
+		},
+		{
+			Name:     "invalid_interval",
+			Args:     []string{"-n", "soon", "true"},
+			WantErr:  "invalid interval",
+			WantCode: core.ExitUsage,
+		},
+		{
+			Name:     "invalid_option",
+			Args:     []string{"-z", "true"},
+			WantCode: core.ExitUsage,
+		},
 	}
 	testutil.RunAppletTests(t, watch.Run, tests)
 }
+
+func TestWatchPrecise(t *testing.T) {
+	// The first run takes 0.7s of a 0.5s interval. With -p the second run
+	// starts at the next free boundary, 1.0s; plain watch waits a full
+	// interval after the run ends, 1.2s.
+	slowFirst := "test -f seen && echo done || { touch seen; sleep 0.7; echo slow; }"
+	for _, tc := range []struct {
+		name     string
+		args     []string
+		min, max time.Duration
+	}{
+		{"precise", []string{"-p", "-g", "-t", "-n", "0.5", slowFirst}, 950 * time.Millisecond, 1150 * time.Millisecond},
+		{"plain", []string{"-g", "-t", "-n", "0.5", slowFirst}, 1150 * time.Millisecond, 1500 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			start := time.Now()
+			out, _, code := testutil.CaptureAndRun(t, watch.Run, tc.args, "")
+			elapsed := time.Since(start)
+			if code != core.ExitSuccess || out.String() != "slow\n\ndone\n" {
+				t.Fatalf("code %d, output %q", code, out)
+			}
+			if elapsed < tc.min || elapsed > tc.max {
+				t.Errorf("second run after %v, want between %v and %v", elapsed, tc.min, tc.max)
+			}
+		})
+	}
+}
+
+// screen collects everything watch writes to the pseudo-terminal.
+type screen struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *screen) waitFor(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		found := strings.Contains(s.buf.String(), want)
+		s.mu.Unlock()
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.Fatalf("timed out waiting for %q in %q", want, s.buf.String())
+}
+
+func TestWatchDifferences(t *testing.T) {
+	master, slave := testutil.OpenPTY(t)
+	var out screen
+	go func() { _, _ = io.Copy(&out, master) }()
+
+	dir := t.TempDir()
+	command := "cd " + filepath.ToSlash(dir) + " && " + once
+	stdio := &core.Stdio{In: strings.NewReader(""), Out: slave, Err: slave}
+	done := make(chan int, 1)
+	go func() { done <- watch.Run(stdio, []string{"-d", "-g", "-n", "0.1", command}) }()
+	select {
+	case code := <-done:
+		if code != core.ExitSuccess {
+			t.Fatalf("exit code = %d, want 0", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("watch -g did not exit after the output changed")
+	}
+
+	out.waitFor(t, "val=0\x1b[K")
+	out.waitFor(t, "val=\x1b[7m1\x1b[m\x1b[K")
+	out.waitFor(t, "\x1b[?25h")
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if strings.Count(out.buf.String(), "\x1b[2J") != 1 {
+		t.Errorf("screen cleared more than once: %q", out.buf.String())
+	}
+}
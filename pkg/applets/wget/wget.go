@@ -2,29 +2,77 @@
 package wget
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/core"
+	"golang.org/x/term"
 )
 
 // Run executes the wget command with the given arguments.
 //
 // Supported flags:
 //
-//	-q          Quiet mode (suppress progress output)
-//	-O FILE     Write output to FILE instead of deriving name from URL
+//	-q, --quiet Quiet mode (no output except errors)
+//	-nv, --no-verbose
+//	            Print one summary line per download instead of progress
+//	-O FILE     Write output to FILE ("-" for stdout) instead of deriving
+//	            the name from the URL
 //	-P DIR      Save files to DIR (overridden by -O)
-//	-c          Continue (accepted for compatibility, not implemented)
+//	-c          Continue a partial download
+//	--header 'NAME: VALUE'
+//	            Add a request header (repeatable)
+//	--post-data STRING
+//	            Send STRING as the body of a POST request
+//	--post-file FILE
+//	            Send the contents of FILE as the body of a POST request
+//	--user USER, --password PASS
+//	            Credentials for HTTP basic authentication
+//	--max-redirect N
+//	            Follow at most N redirects (default 20)
+//	--no-redirect
+//	            Do not follow redirects
+//	-t, --tries N
+//	            Make up to N attempts, 0 or "inf" for no limit (default 1)
+//	--waitretry SECS
+//	            Longest pause between attempts (default 10)
+//	--retry-post
+//	            Allow a POST to be sent again when retrying
 //
 // When -O is specified it takes precedence over -P: the file is saved to the
 // current directory with the -O name. When only -P is given, files are saved
 // under the prefix directory with a name derived from the URL path.
+//
+// With -c an existing file is resumed by requesting the missing bytes with
+// a Range header. The data is appended only if the server answers 206 with
+// a matching Content-Range; a plain 200 means the range was ignored and
+// the file is downloaded again from the start.
+//
+// Posted data is sent as application/x-www-form-urlencoded unless a
+// Content-Type is given with --header. Redirects follow the usual client
+// rules: the Authorization header is kept only while the target stays on
+// the same host or one of its subdomains, and a POST redirected with 301,
+// 302 or 303 is repeated as a GET without the body.
+//
+// Connection failures and 5xx replies are retried while tries remain,
+// pausing 1s after the first failure, 2s after the second and so on up
+// to --waitretry. A POST is tried only once unless --retry-post is given,
+// since the server may already have acted on it.
+//
+// While downloading, a progress line on stderr shows the percentage,
+// bytes received, rate and ETA, or just bytes and rate when the server
+// sends no Content-Length. On a terminal it is redrawn in place a few
+// times a second; otherwise only the final state is printed.
 func Run(stdio *core.Stdio, args []string) int {
 	if len(args) == 0 {
 		return core.UsageError(stdio, "wget", "missing URL")
@@ -34,7 +82,20 @@ func Run(stdio *core.Stdio, args []string) int {
 		outFile   string
 		prefix    string
 		quiet     bool
+		noVerbose bool
 		continueF bool
+		headers   []string
+		postData  string
+		postFile  string
+		posting   bool
+		user      string
+		password  string
+		hasAuth   bool
+
+		maxRedirect = 20
+		tries       = 1
+		waitRetry   = 10 * time.Second
+		retryPost   bool
 	)
 
 	i := 0
@@ -47,7 +108,75 @@ func Run(stdio *core.Stdio, args []string) int {
 		if !strings.HasPrefix(arg, "-") || arg == "-" {
 			break
 		}
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg, "=")
+			switch name {
+			case "--no-redirect":
+				maxRedirect = 0
+				i++
+				continue
+			case "--quiet":
+				quiet = true
+				i++
+				continue
+			case "--no-verbose":
+				noVerbose = true
+				i++
+				continue
+			case "--retry-post":
+				retryPost = true
+				i++
+				continue
+			case "--header", "--post-data", "--post-file", "--user", "--http-user", "--password", "--http-password",
+				"--max-redirect", "--tries", "--waitretry":
+			default:
+				// ignore unknown long options
+				i++
+				continue
+			}
+			if !hasValue {
+				i++
+				if i >= len(args) {
+					return core.UsageError(stdio, "wget", name+" requires argument")
+				}
+				value = args[i]
+			}
+			switch name {
+			case "--header":
+				headers = append(headers, value)
+			case "--post-data":
+				postData, postFile, posting = value, "", true
+			case "--post-file":
+				postData, postFile, posting = "", value, true
+			case "--user", "--http-user":
+				user, hasAuth = value, true
+			case "--password", "--http-password":
+				password, hasAuth = value, true
+			case "--max-redirect":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return core.UsageError(stdio, "wget", "invalid number '"+value+"'")
+				}
+				maxRedirect = n
+			case "--tries":
+				n, ok := parseTries(value)
+				if !ok {
+					return core.UsageError(stdio, "wget", "invalid number '"+value+"'")
+				}
+				tries = n
+			case "--waitretry":
+				secs, err := strconv.ParseFloat(value, 64)
+				if err != nil || secs < 0 || math.IsNaN(secs) || math.IsInf(secs, 0) {
+					return core.UsageError(stdio, "wget", "invalid number '"+value+"'")
+				}
+				waitRetry = time.Duration(secs * float64(time.Second))
+			}
+			i++
+			continue
+		}
 		switch {
+		case arg == "-nv":
+			noVerbose = true
 		case arg == "-O":
 			i++
 			if i >= len(args) {
@@ -101,6 +230,22 @@ func Run(stdio *core.Stdio, args []string) int {
 					}
 					j = len(flags)
 					continue
+				case 't':
+					value := flags[j+1:]
+					if value == "" {
+						i++
+						if i >= len(args) {
+							return core.UsageError(stdio, "wget", "-t requires argument")
+						}
+						value = args[i]
+					}
+					n, ok := parseTries(value)
+					if !ok {
+						return core.UsageError(stdio, "wget", "invalid number '"+value+"'")
+					}
+					tries = n
+					j = len(flags)
+					continue
 				default:
 					// ignore unknown flags
 				}
@@ -109,29 +254,14 @@ func Run(stdio *core.Stdio, args []string) int {
 		}
 		i++
 	}
-	_ = continueF
 
 	if i >= len(args) {
 		return core.UsageError(stdio, "wget", "missing URL")
 	}
 	rawURL := args[i]
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	resp, err := client.Get(rawURL)
-	if err != nil {
-		stdio.Errorf("wget: can't connect to remote host: %v\n", err)
-		return core.ExitFailure
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		stdio.Errorf("wget: server returned error: HTTP/%d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
-		return core.ExitFailure
-	}
-
 	// Determine output filename
+	toStdout := outFile == "-"
 	dest := outFile
 	if dest == "" {
 		dest = outputName(rawURL)
@@ -143,39 +273,252 @@ func Run(stdio *core.Stdio, args []string) int {
 		dest = filepath.Join(prefix, dest)
 	}
 
-	// Ensure parent directory exists
-	dir := filepath.Dir(dest)
-	if dir != "" && dir != "." {
-		os.MkdirAll(dir, 0755)
+	// With -c, ask only for what is missing from the local copy.
+	var offset int64
+	if continueF && !toStdout {
+		if info, err := os.Stat(dest); err == nil && info.Mode().IsRegular() {
+			offset = info.Size()
+		}
 	}
 
-	file, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	method := http.MethodGet
+	var body []byte
+	if posting {
+		method = http.MethodPost
+		body = []byte(postData)
+		if postFile != "" {
+			data, err := os.ReadFile(postFile)
+			if err != nil {
+				stdio.Errorf("wget: can't open '%s': %v\n", postFile, err)
+				return core.ExitFailure
+			}
+			body = data
+		}
+		if !retryPost {
+			tries = 1
+		}
+	}
+	header := make(http.Header)
+	host := ""
+	if posting {
+		header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	// A user header replaces a default one of the same name; repeating
+	// a name sends it more than once.
+	seen := make(map[string]bool)
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			stdio.Errorf("wget: bad header '%s'\n", h)
+			return core.ExitFailure
+		}
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(name, "Host") {
+			host = value
+			continue
+		}
+		key := http.CanonicalHeaderKey(name)
+		if seen[key] {
+			header.Add(key, value)
+		} else {
+			header.Set(key, value)
+			seen[key] = true
+		}
+	}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	// Each attempt needs a fresh request so the body can be sent again.
+	newRequest := func() (*http.Request, error) {
+		var reader io.Reader
+		if posting {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, rawURL, reader)
+		if err != nil {
+			return nil, err
+		}
+		if hasAuth {
+			req.SetBasicAuth(user, password)
+		}
+		for key, values := range header {
+			req.Header[key] = append([]string(nil), values...)
+		}
+		if host != "" {
+			req.Host = host
+		}
+		return req, nil
+	}
+	if _, err := newRequest(); err != nil {
+		stdio.Errorf("wget: bad address '%s'\n", rawURL)
+		return core.ExitFailure
+	}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirect {
+				return errTooManyRedirects{maxRedirect}
+			}
+			return nil
+		},
+	}
+	resp, err := fetch(client, newRequest, tries, waitRetry)
+	var tooMany errTooManyRedirects
+	if errors.As(err, &tooMany) {
+		stdio.Errorf("wget: %v\n", tooMany)
+		return core.ExitFailure
+	}
 	if err != nil {
-		stdio.Errorf("wget: can't open '%s': %v\n", dest, err)
+		stdio.Errorf("wget: can't connect to remote host: %v\n", err)
 		return core.ExitFailure
 	}
-	defer file.Close()
+	defer resp.Body.Close()
 
-	n, err := io.Copy(file, resp.Body)
-	if err != nil {
-		stdio.Errorf("wget: write error: %v\n", err)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// Nothing past the end of the local copy: it is complete.
+		if !quiet {
+			stdio.Errorf("wget: '%s' is already fully retrieved\n", dest)
+		}
+		return core.ExitSuccess
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if start, ok := rangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			stdio.Errorf("wget: server returned unexpected range '%s'\n", resp.Header.Get("Content-Range"))
+			return core.ExitFailure
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		stdio.Errorf("wget: server returned error: HTTP/%d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
 		return core.ExitFailure
 	}
+	// A 200 reply to a range request means the server ignored the
+	// range; the download starts over and the file is truncated.
 
-	if !quiet {
-		if outFile == "-" {
-			// writing to stdout
+	verbose := !quiet && !noVerbose
+	if verbose {
+		stdio.Errorf("Connecting to %s (%s)\n", hostFromURL(rawURL), hostFromURL(rawURL))
+		if toStdout {
+			stdio.Errorf("Writing to stdout\n")
 		} else {
-			stdio.Errorf("Connecting to %s (%s)\n", hostFromURL(rawURL), hostFromURL(rawURL))
 			stdio.Errorf("Writing to '%s'\n", dest)
-			stdio.Errorf("%-20s 100%% |%s|%5d  0:00:00 ETA\n", dest, progressBar(), n)
-			stdio.Errorf("download complete\n")
 		}
 	}
 
+	var out io.Writer = stdio.Out
+	if !toStdout {
+		// Ensure parent directory exists
+		dir := filepath.Dir(dest)
+		if dir != "" && dir != "." {
+			os.MkdirAll(dir, 0755)
+		}
+
+		file, err := os.OpenFile(dest, flags, 0644)
+		if err != nil {
+			stdio.Errorf("wget: can't open '%s': %v\n", dest, err)
+			return core.ExitFailure
+		}
+		defer file.Close()
+		out = file
+	}
+
+	// A resumed download counts the local bytes as already done.
+	var done int64
+	total := resp.ContentLength
+	if resp.StatusCode == http.StatusPartialContent {
+		done = offset
+		if total >= 0 {
+			total += offset
+		}
+	}
+	name := dest
+	if toStdout {
+		name = "-"
+	}
+	var meter *progress
+	var src io.Reader = resp.Body
+	if verbose {
+		meter = newProgress(stdio, name, done, total)
+		src = io.TeeReader(resp.Body, meter)
+	}
+	n, err := io.Copy(out, src)
+	if meter != nil {
+		meter.finish()
+	}
+	if err != nil {
+		stdio.Errorf("wget: write error: %v\n", err)
+		return core.ExitFailure
+	}
+
+	switch {
+	case verbose:
+		stdio.Errorf("download complete\n")
+	case noVerbose:
+		stdio.Errorf("%s URL:%s [%d/%d] -> \"%s\" [1]\n",
+			time.Now().Format("2006-01-02 15:04:05"), resp.Request.URL, done+n, max(total, done+n), name)
+	}
+
 	return core.ExitSuccess
 }
 
+// errTooManyRedirects stops a redirect chain longer than --max-redirect.
+type errTooManyRedirects struct{ max int }
+
+func (e errTooManyRedirects) Error() string {
+	return fmt.Sprintf("%d redirections exceeded", e.max)
+}
+
+// fetch sends the request built by newRequest, trying again after
+// connection failures and 5xx replies until tries attempts have been
+// made (0 means no limit). The last reply or error is returned.
+func fetch(client *http.Client, newRequest func() (*http.Request, error), tries int, waitRetry time.Duration) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		var tooMany errTooManyRedirects
+		switch {
+		case errors.As(err, &tooMany):
+			return nil, err
+		case err == nil && resp.StatusCode < 500:
+			return resp, nil
+		case tries != 0 && attempt >= tries:
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		time.Sleep(min(time.Duration(attempt)*time.Second, waitRetry))
+	}
+}
+
+// parseTries parses a --tries value; 0 and "inf" mean no limit.
+func parseTries(value string) (int, bool) {
+	if value == "inf" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil && n >= 0
+}
+
+// rangeStart returns the first byte position of a Content-Range value
+// such as "bytes 100-199/200".
+func rangeStart(value string) (int64, bool) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(first, 10, 64)
+	return n, err == nil
+}
+
 // hostFromURL extracts the host component from a raw URL string.
 func hostFromURL(rawURL string) string {
 	parsed, err := url.Parse(rawURL)
@@ -185,8 +528,102 @@ func hostFromURL(rawURL string) string {
 	return rawURL
 }
 
-func progressBar() string {
-	return strings.Repeat("*", 30)
+// progressWidth is the number of cells in the progress bar.
+const progressWidth = 30
+
+// progressEvery limits how often the progress line is redrawn.
+const progressEvery = 200 * time.Millisecond
+
+// progress draws the download meter on stderr. It is an io.Writer fed
+// with the body as it is copied.
+type progress struct {
+	stdio *core.Stdio
+	name  string
+	tty   bool
+	start time.Time
+	drawn time.Time
+	base  int64 // bytes present before this transfer started
+	done  int64
+	total int64 // -1 when the length is unknown
+}
+
+func newProgress(stdio *core.Stdio, name string, done, total int64) *progress {
+	f, ok := stdio.Err.(*os.File)
+	return &progress{
+		stdio: stdio,
+		name:  name,
+		tty:   ok && term.IsTerminal(int(f.Fd())),
+		start: time.Now(),
+		base:  done,
+		done:  done,
+		total: total,
+	}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if p.tty && time.Since(p.drawn) >= progressEvery {
+		p.drawn = time.Now()
+		p.stdio.Errorf("\r%s", p.line(false))
+	}
+	return len(b), nil
+}
+
+// finish draws the final state and ends the line.
+func (p *progress) finish() {
+	if p.tty {
+		p.stdio.Errorf("\r")
+	}
+	p.stdio.Errorf("%s\n", p.line(true))
+}
+
+func (p *progress) line(final bool) string {
+	elapsed := time.Since(p.start)
+	rate := float64(0)
+	if secs := elapsed.Seconds(); secs > 0 {
+		rate = float64(p.done-p.base) / secs
+	}
+	speed := formatSize(int64(rate)) + "/s"
+	if p.total < 0 {
+		return fmt.Sprintf("%-20.20s %7s %9s", p.name, formatSize(p.done), speed)
+	}
+	pct := int64(100)
+	if p.total > 0 {
+		pct = min(p.done*100/p.total, 100)
+	}
+	cells := int(pct) * progressWidth / 100
+	bar := strings.Repeat("*", cells) + strings.Repeat(" ", progressWidth-cells)
+	// The final line shows the time taken instead of the time left.
+	eta := "--:--:-- ETA"
+	switch {
+	case final:
+		eta = formatClock(elapsed)
+	case rate > 0:
+		eta = formatClock(time.Duration(float64(p.total-p.done)/rate*float64(time.Second))) + " ETA"
+	}
+	return fmt.Sprintf("%-20.20s %3d%% |%s| %7s %9s %s", p.name, pct, bar, formatSize(p.done), speed, eta)
+}
+
+// formatSize prints a byte count with a k, M or G suffix once it no
+// longer fits in five digits.
+func formatSize(n int64) string {
+	value := float64(n)
+	for _, unit := range []string{"", "k", "M", "G"} {
+		if value < 100000 || unit == "G" {
+			if unit == "" {
+				return strconv.FormatInt(n, 10)
+			}
+			return fmt.Sprintf("%.0f%s", value, unit)
+		}
+		value /= 1024
+	}
+	return ""
+}
+
+// formatClock prints d as h:mm:ss.
+func formatClock(d time.Duration) string {
+	secs := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
 }
 
 // outputName derives a local filename from the URL path.
@@ -210,4 +647,3 @@ func outputName(rawURL string) string {
 	}
 	return base
 }
-
@@ -1,9 +1,16 @@
 package wget_test
 
 import (
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rcarmo/go-busybox/pkg/applets/wget"
 	"github.com/rcarmo/go-busybox/pkg/core"
@@ -38,6 +45,521 @@ func TestWget(t *testing.T) {
 				testutil.AssertFileExists(t, dir+"/out.txt")
 			},
 		},
+		{
+			Name:     "output_stdout",
+			Args:     []string{"-q", "-O", "-", server.URL},
+			WantCode: core.ExitSuccess,
+			WantOut:  "hello",
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileNotExists(t, dir+"/-")
+				testutil.AssertFileNotExists(t, dir+"/index.html")
+			},
+		},
+	}
+	testutil.RunAppletTests(t, wget.Run, tests)
+}
+
+func TestWgetContinue(t *testing.T) {
+	const body = "0123456789abcdefghij"
+	var ranges []string
+	var mu sync.Mutex
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		ranges = append(ranges, r.Header.Get("Range"))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ranged", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.ServeContent(w, r, "ranged", time.Time{}, strings.NewReader(body))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write([]byte(body))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	lastRange := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return ranges[len(ranges)-1]
+	}
+
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "resume",
+			Args:     []string{"-q", "-c", "-O", "out.bin", server.URL + "/ranged"},
+			Files:    map[string]string{"out.bin": body[:7]},
+			WantCode: core.ExitSuccess,
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileContent(t, dir+"/out.bin", body)
+				if got := lastRange(); got != "bytes=7-" {
+					t.Errorf("Range header = %q, want bytes=7-", got)
+				}
+			},
+		},
+		{
+			Name:     "range_ignored",
+			Args:     []string{"-qc", "-O", "out.bin", server.URL + "/plain"},
+			Files:    map[string]string{"out.bin": "stale partial"},
+			WantCode: core.ExitSuccess,
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileContent(t, dir+"/out.bin", body)
+				if got := lastRange(); got != "bytes=13-" {
+					t.Errorf("Range header = %q, want bytes=13-", got)
+				}
+			},
+		},
+		{
+			Name:     "already_complete",
+			Args:     []string{"-c", "-O", "out.bin", server.URL + "/ranged"},
+			Files:    map[string]string{"out.bin": body},
+			WantCode: core.ExitSuccess,
+			WantErr:  "already fully retrieved",
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileContent(t, dir+"/out.bin", body)
+			},
+		},
+		{
+			Name:     "no_local_copy",
+			Args:     []string{"-q", "-c", server.URL + "/ranged"},
+			WantCode: core.ExitSuccess,
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileContent(t, dir+"/ranged", body)
+				if got := lastRange(); got != "" {
+					t.Errorf("Range header = %q, want none", got)
+				}
+			},
+		},
+		{
+			Name:     "without_c_overwrites",
+			Args:     []string{"-q", "-O", "out.bin", server.URL + "/ranged"},
+			Files:    map[string]string{"out.bin": body[:7]},
+			WantCode: core.ExitSuccess,
+			Check: func(t *testing.T, dir string) {
+				testutil.AssertFileContent(t, dir+"/out.bin", body)
+				if got := lastRange(); got != "" {
+					t.Errorf("Range header = %q, want none", got)
+				}
+			},
+		},
+	}
+	testutil.RunAppletTests(t, wget.Run, tests)
+}
+
+func TestWgetRequest(t *testing.T) {
+	type received struct {
+		method string
+		header http.Header
+		body   string
+	}
+	var (
+		mu   sync.Mutex
+		last received
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		last = received{method: r.Method, header: r.Header.Clone(), body: string(body)}
+		mu.Unlock()
+		_, _ = w.Write([]byte("ok"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	// The same server under another host name, for redirects that leave
+	// the original host.
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	mux.HandleFunc("/found", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusFound)
+	})
+	mux.HandleFunc("/temporary", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other+"/echo", http.StatusFound)
+	})
+
+	got := func() received {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+	expect := func(method, body string, header map[string]string) func(*testing.T, string) {
+		return func(t *testing.T, dir string) {
+			r := got()
+			if r.method != method {
+				t.Errorf("method = %s, want %s", r.method, method)
+			}
+			if r.body != body {
+				t.Errorf("body = %q, want %q", r.body, body)
+			}
+			for name, want := range header {
+				if have := strings.Join(r.header.Values(name), ", "); have != want {
+					t.Errorf("%s = %q, want %q", name, have, want)
+				}
+			}
+		}
+	}
+	// "alice:secret" in base64.
+	const auth = "Basic YWxpY2U6c2VjcmV0"
+
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "headers",
+			Args:     []string{"-q", "-O", "-", "--header=X-Token: abc", "--header", "Accept: text/plain", "--header", "X-Token: def", server.URL + "/echo"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodGet, "", map[string]string{"X-Token": "abc, def", "Accept": "text/plain"}),
+		},
+		{
+			Name:     "bad_header",
+			Args:     []string{"-q", "--header", "no colon", server.URL + "/echo"},
+			WantErr:  "wget: bad header 'no colon'",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "post_data",
+			Args:     []string{"-q", "-O", "-", "--post-data=a=1&b=2", server.URL + "/echo"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check: expect(http.MethodPost, "a=1&b=2", map[string]string{
+				"Content-Type":   "application/x-www-form-urlencoded",
+				"Content-Length": "7",
+			}),
+		},
+		{
+			Name:     "post_file",
+			Args:     []string{"-q", "-O", "-", "--post-file", "body.json", "--header", "Content-Type: application/json", server.URL + "/echo"},
+			Files:    map[string]string{"body.json": `{"n":1}`},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodPost, `{"n":1}`, map[string]string{"Content-Type": "application/json"}),
+		},
+		{
+			Name:     "post_file_missing",
+			Args:     []string{"-q", "--post-file", "absent", server.URL + "/echo"},
+			WantErr:  "wget: can't open 'absent'",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "basic_auth",
+			Args:     []string{"-q", "-O", "-", "--user=alice", "--password", "secret", server.URL + "/echo"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodGet, "", map[string]string{"Authorization": auth}),
+		},
+		{
+			Name:     "auth_kept_on_same_host",
+			Args:     []string{"-q", "-O", "-", "--user", "alice", "--password", "secret", server.URL + "/found"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodGet, "", map[string]string{"Authorization": auth}),
+		},
+		{
+			Name:     "auth_dropped_on_other_host",
+			Args:     []string{"-q", "-O", "-", "--user", "alice", "--password", "secret", "--header", "X-Token: abc", server.URL + "/elsewhere"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodGet, "", map[string]string{"Authorization": "", "X-Token": "abc"}),
+		},
+		{
+			Name:     "post_redirect_found",
+			Args:     []string{"-q", "-O", "-", "--post-data", "x=1", server.URL + "/found"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodGet, "", nil),
+		},
+		{
+			Name:     "post_redirect_temporary",
+			Args:     []string{"-q", "-O", "-", "--post-data", "x=1", server.URL + "/temporary"},
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    expect(http.MethodPost, "x=1", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}),
+		},
+	}
+	testutil.RunAppletTests(t, wget.Run, tests)
+}
+
+func TestWgetRedirectsAndRetries(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		hits  int
+		fails int
+	)
+	// hit counts a request and reports whether it should fail.
+	hit := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		return hits <= fails
+	}
+	reset := func(n int) func(*testing.T, string) {
+		return func(*testing.T, string) {
+			mu.Lock()
+			defer mu.Unlock()
+			hits, fails = 0, n
+		}
+	}
+	wantHits := func(n int) func(*testing.T, string) {
+		return func(t *testing.T, dir string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if hits != n {
+				t.Errorf("server saw %d requests, want %d", hits, n)
+			}
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		hit()
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/chain/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/chain/"))
+		if n > 0 {
+			http.Redirect(w, r, "/chain/"+strconv.Itoa(n-1), http.StatusMovedPermanently)
+			return
+		}
+		_, _ = w.Write([]byte("end"))
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if hit() {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+		if hit() {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.(*net.TCPConn).SetLinger(0)
+				conn.Close()
+			}
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		hit()
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	tests := []testutil.AppletTestCase{
+		{
+			Name:     "redirect_loop",
+			Args:     []string{"-q", "--max-redirect=3", server.URL + "/loop"},
+			Setup:    reset(0),
+			WantErr:  "wget: 3 redirections exceeded",
+			WantCode: core.ExitFailure,
+			Check: func(t *testing.T, dir string) {
+				wantHits(4)(t, dir)
+				testutil.AssertFileNotExists(t, dir+"/loop")
+			},
+		},
+		{
+			Name:     "redirect_loop_default_limit",
+			Args:     []string{"-q", "-t", "3", server.URL + "/loop"},
+			Setup:    reset(0),
+			WantErr:  "wget: 20 redirections exceeded",
+			WantCode: core.ExitFailure,
+			Check:    wantHits(21),
+		},
+		{
+			Name:     "redirect_chain_within_limit",
+			Args:     []string{"-q", "-O", "-", "--max-redirect", "2", server.URL + "/chain/2"},
+			WantOut:  "end",
+			WantCode: core.ExitSuccess,
+		},
+		{
+			Name:     "redirect_chain_over_limit",
+			Args:     []string{"-q", "-O", "-", "--max-redirect", "2", server.URL + "/chain/3"},
+			WantErr:  "wget: 2 redirections exceeded",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "no_redirect",
+			Args:     []string{"-q", "-O", "-", "--no-redirect", server.URL + "/chain/1"},
+			WantErr:  "wget: 0 redirections exceeded",
+			WantCode: core.ExitFailure,
+		},
+		{
+			Name:     "flaky_third_try",
+			Args:     []string{"-q", "-O", "-", "-t", "3", "--waitretry=0.01", server.URL + "/flaky"},
+			Setup:    reset(2),
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    wantHits(3),
+		},
+		{
+			Name:     "flaky_out_of_tries",
+			Args:     []string{"-q", "-O", "-", "--tries=2", "--waitretry=0.01", server.URL + "/flaky"},
+			Setup:    reset(2),
+			WantErr:  "HTTP/503",
+			WantCode: core.ExitFailure,
+			Check:    wantHits(2),
+		},
+		{
+			Name:     "no_retry_by_default",
+			Args:     []string{"-q", "-O", "-", server.URL + "/flaky"},
+			Setup:    reset(2),
+			WantCode: core.ExitFailure,
+			Check:    wantHits(1),
+		},
+		{
+			Name:     "connection_reset",
+			Args:     []string{"-q", "-O", "-", "-t3", "--waitretry=0.01", server.URL + "/reset"},
+			Setup:    reset(1),
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    wantHits(2),
+		},
+		{
+			Name:     "client_error_not_retried",
+			Args:     []string{"-q", "-O", "-", "-t", "3", "--waitretry=0.01", server.URL + "/missing"},
+			Setup:    reset(0),
+			WantErr:  "HTTP/404",
+			WantCode: core.ExitFailure,
+			Check:    wantHits(1),
+		},
+		{
+			Name:     "post_not_retried",
+			Args:     []string{"-q", "-O", "-", "-t", "3", "--waitretry=0.01", "--post-data=x=1", server.URL + "/flaky"},
+			Setup:    reset(2),
+			WantCode: core.ExitFailure,
+			Check:    wantHits(1),
+		},
+		{
+			Name:     "post_retried_when_allowed",
+			Args:     []string{"-q", "-O", "-", "-t", "3", "--waitretry=0.01", "--retry-post", "--post-data=x=1", server.URL + "/flaky"},
+			Setup:    reset(2),
+			WantOut:  "ok",
+			WantCode: core.ExitSuccess,
+			Check:    wantHits(3),
+		},
+		{
+			Name:     "invalid_tries",
+			Args:     []string{"-t", "many", server.URL},
+			WantCode: core.ExitUsage,
+		},
 	}
 	testutil.RunAppletTests(t, wget.Run, tests)
 }
+
+func TestWgetProgress(t *testing.T) {
+	const body = "hello"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before the end forces chunked encoding, so the
+		// length is unknown.
+		_, _ = w.Write([]byte(body[:2]))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(body[2:]))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10000")
+		chunk := strings.Repeat("x", 1000)
+		for range 10 {
+			_, _ = w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	run := func(t *testing.T, args ...string) string {
+		t.Helper()
+		t.Chdir(t.TempDir())
+		_, errBuf, code := testutil.CaptureAndRun(t, wget.Run, args, "")
+		if code != core.ExitSuccess {
+			t.Fatalf("exit code %d: %s", code, errBuf)
+		}
+		return errBuf.String()
+	}
+
+	t.Run("quiet", func(t *testing.T) {
+		for _, flag := range []string{"-q", "--quiet"} {
+			if got := run(t, flag, "-O", "out.txt", server.URL+"/file"); got != "" {
+				t.Errorf("%s: stderr = %q, want nothing", flag, got)
+			}
+		}
+	})
+	t.Run("no_verbose", func(t *testing.T) {
+		for _, flag := range []string{"-nv", "--no-verbose"} {
+			got := run(t, flag, "-O", "out.txt", server.URL+"/file")
+			want := regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d URL:` + regexp.QuoteMeta(server.URL+"/file") + ` \[5/5\] -> "out.txt" \[1\]\n$`)
+			if !want.MatchString(got) {
+				t.Errorf("%s: stderr = %q, want one summary line", flag, got)
+			}
+		}
+	})
+	t.Run("known_length", func(t *testing.T) {
+		got := run(t, "-O", "out.txt", server.URL+"/file")
+		if !strings.Contains(got, "out.txt              100% |"+strings.Repeat("*", 30)+"|       5 ") {
+			t.Errorf("stderr = %q, want a finished progress bar", got)
+		}
+		if strings.Contains(got, "\r") {
+			t.Errorf("stderr = %q, want no redraws when not a terminal", got)
+		}
+	})
+	t.Run("unknown_length", func(t *testing.T) {
+		got := run(t, "-O", "out.txt", server.URL+"/stream")
+		if !strings.Contains(got, "out.txt                    5 ") || strings.Contains(got, "%") {
+			t.Errorf("stderr = %q, want a byte count without percentage", got)
+		}
+	})
+	t.Run("terminal", func(t *testing.T) {
+		master, slave := testutil.OpenPTY(t)
+		var (
+			mu     sync.Mutex
+			screen strings.Builder
+		)
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				n, err := master.Read(buf)
+				mu.Lock()
+				screen.Write(buf[:n])
+				mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}()
+		t.Chdir(t.TempDir())
+		stdio := &core.Stdio{In: strings.NewReader(""), Out: io.Discard, Err: slave}
+		if code := wget.Run(stdio, []string{"-O", "out.bin", server.URL + "/slow"}); code != core.ExitSuccess {
+			t.Fatalf("exit code %d", code)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			got := screen.String()
+			mu.Unlock()
+			if strings.Contains(got, "download complete") {
+				// About one second of transfer allows five redraws
+				// plus the final line.
+				if n := strings.Count(got, "% |"); n < 2 || n > 8 {
+					t.Errorf("progress drawn %d times, want a few throttled updates:\n%q", n, got)
+				}
+				if !strings.Contains(got, " ETA\r") {
+					t.Errorf("want in-place redraws with an ETA:\n%q", got)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out; screen %q", got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
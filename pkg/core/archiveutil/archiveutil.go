@@ -2,8 +2,10 @@
 package archiveutil
 
 import (
+	"compress/bzip2"
 	"compress/gzip"
 	"io"
+	"strings"
 )
 
 const maxArchiveBytes = int64(64 << 20)
@@ -32,3 +34,80 @@ func GunzipToWriter(r io.Reader, w io.Writer) error {
 	}
 	return zr.Close()
 }
+
+// Codec identifies a compression format understood by the archive applets.
+type Codec int
+
+// Supported codecs.
+const (
+	CodecNone Codec = iota
+	CodecGzip
+	CodecBzip2
+	CodecXZ
+)
+
+// DetectCodec identifies the compression format from the leading bytes of
+// a stream. Unknown or short input yields CodecNone.
+func DetectCodec(head []byte) Codec {
+	switch {
+	case len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b:
+		return CodecGzip
+	case len(head) >= 3 && string(head[:3]) == "BZh":
+		return CodecBzip2
+	case len(head) >= 6 && string(head[:6]) == string(xzMagic):
+		return CodecXZ
+	}
+	return CodecNone
+}
+
+// CodecForName picks a codec from an archive file name suffix, as tar -a
+// does.
+func CodecForName(name string) Codec {
+	lower := strings.ToLower(name)
+	for _, s := range []struct {
+		suffix string
+		codec  Codec
+	}{
+		{".tar.gz", CodecGzip}, {".tgz", CodecGzip}, {".taz", CodecGzip}, {".gz", CodecGzip},
+		{".tar.bz2", CodecBzip2}, {".tbz", CodecBzip2}, {".tbz2", CodecBzip2}, {".tz2", CodecBzip2}, {".bz2", CodecBzip2},
+		{".tar.xz", CodecXZ}, {".txz", CodecXZ}, {".xz", CodecXZ},
+	} {
+		if strings.HasSuffix(lower, s.suffix) {
+			return s.codec
+		}
+	}
+	return CodecNone
+}
+
+// NewCodecWriter wraps w so that data written is compressed with c.
+// Closing the returned writer flushes the compressor but not w.
+func NewCodecWriter(c Codec, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	case CodecBzip2:
+		return NewBzip2Writer(w, 9)
+	case CodecXZ:
+		return NewXZWriter(w), nil
+	}
+	return nopCloser{w}, nil
+}
+
+// NewCodecReader wraps r so that reads return data decompressed with c.
+func NewCodecReader(c Codec, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case CodecXZ:
+		return NewXZReader(r), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,450 @@
+package archiveutil
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// The standard library only decompresses bzip2, so this file provides a
+// small encoder: run-length pre-pass, Burrows-Wheeler transform,
+// move-to-front, zero-run coding and a single Huffman table per block.
+
+const (
+	bzBlockMagic = 0x314159265359
+	bzEndMagic   = 0x177245385090
+	bzMaxCodeLen = 17
+	bzGroupSize  = 50
+)
+
+var bzCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+type bzBitWriter struct {
+	w    io.Writer
+	acc  uint64
+	bits uint
+	buf  []byte
+	err  error
+}
+
+func (b *bzBitWriter) writeBits(n uint, v uint64) {
+	b.acc = b.acc<<n | v&(1<<n-1)
+	b.bits += n
+	for b.bits >= 8 {
+		b.bits -= 8
+		b.buf = append(b.buf, byte(b.acc>>b.bits))
+	}
+	if len(b.buf) >= 4096 {
+		b.flushBytes()
+	}
+}
+
+func (b *bzBitWriter) writeBit(bit bool) {
+	if bit {
+		b.writeBits(1, 1)
+	} else {
+		b.writeBits(1, 0)
+	}
+}
+
+func (b *bzBitWriter) flushBytes() {
+	if b.err == nil && len(b.buf) > 0 {
+		_, b.err = b.w.Write(b.buf)
+	}
+	b.buf = b.buf[:0]
+}
+
+// finish pads the final partial byte with zero bits and flushes.
+func (b *bzBitWriter) finish() error {
+	if b.bits > 0 {
+		b.writeBits(8-b.bits, 0)
+	}
+	b.flushBytes()
+	return b.err
+}
+
+// bzip2Writer compresses data written to it in bzip2 format.
+type bzip2Writer struct {
+	bw       bzBitWriter
+	level    int
+	limit    int
+	block    []byte
+	blockCRC uint32
+	crc      uint32
+	runByte  byte
+	runLen   int
+	started  bool
+	closed   bool
+}
+
+// NewBzip2Writer returns a writer that compresses to w using blocks of
+// level*100k bytes. level must be between 1 and 9.
+func NewBzip2Writer(w io.Writer, level int) (io.WriteCloser, error) {
+	if level < 1 || level > 9 {
+		return nil, errors.New("bzip2: invalid compression level")
+	}
+	return &bzip2Writer{
+		bw:       bzBitWriter{w: w},
+		level:    level,
+		limit:    level*100000 - 19,
+		blockCRC: 0xffffffff,
+	}, nil
+}
+
+func (z *bzip2Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("bzip2: write after close")
+	}
+	for _, c := range p {
+		if z.runLen > 0 && (c != z.runByte || z.runLen == 255) {
+			z.flushRun()
+		}
+		z.runByte = c
+		z.runLen++
+	}
+	return len(p), z.bw.err
+}
+
+// flushRun appends the pending run to the block using bzip2's initial
+// run-length encoding: four copies followed by a count of extra repeats.
+func (z *bzip2Writer) flushRun() {
+	need := z.runLen
+	if need >= 4 {
+		need = 5
+	}
+	if len(z.block)+need > z.limit {
+		z.writeBlock()
+	}
+	for i := 0; i < z.runLen; i++ {
+		z.blockCRC = z.blockCRC<<8 ^ bzCRCTable[byte(z.blockCRC>>24)^z.runByte]
+	}
+	if z.runLen < 4 {
+		for i := 0; i < z.runLen; i++ {
+			z.block = append(z.block, z.runByte)
+		}
+	} else {
+		z.block = append(z.block, z.runByte, z.runByte, z.runByte, z.runByte, byte(z.runLen-4))
+	}
+	z.runLen = 0
+}
+
+func (z *bzip2Writer) writeHeader() {
+	if !z.started {
+		z.started = true
+		z.bw.writeBits(8, 'B')
+		z.bw.writeBits(8, 'Z')
+		z.bw.writeBits(8, 'h')
+		z.bw.writeBits(8, uint64('0'+z.level))
+	}
+}
+
+func (z *bzip2Writer) Close() error {
+	if z.closed {
+		return z.bw.err
+	}
+	z.closed = true
+	if z.runLen > 0 {
+		z.flushRun()
+	}
+	if len(z.block) > 0 {
+		z.writeBlock()
+	}
+	z.writeHeader()
+	z.bw.writeBits(24, bzEndMagic>>24)
+	z.bw.writeBits(24, bzEndMagic&0xffffff)
+	z.bw.writeBits(32, uint64(z.crc))
+	return z.bw.finish()
+}
+
+func (z *bzip2Writer) writeBlock() {
+	z.writeHeader()
+	blockCRC := ^z.blockCRC
+	z.crc = (z.crc<<1 | z.crc>>31) ^ blockCRC
+	z.blockCRC = 0xffffffff
+
+	data := z.block
+	z.block = z.block[:0]
+	bwt, origPtr := bzTransform(data)
+
+	bw := &z.bw
+	bw.writeBits(24, bzBlockMagic>>24)
+	bw.writeBits(24, bzBlockMagic&0xffffff)
+	bw.writeBits(32, uint64(blockCRC))
+	bw.writeBits(1, 0) // not randomised
+	bw.writeBits(24, uint64(origPtr))
+
+	// Symbol map: which byte values occur, as 16 ranges of 16.
+	var inUse [256]bool
+	for _, c := range data {
+		inUse[c] = true
+	}
+	var unseqToSeq [256]byte
+	numInUse := 0
+	var ranges uint16
+	for i := 0; i < 256; i++ {
+		if inUse[i] {
+			unseqToSeq[i] = byte(numInUse)
+			numInUse++
+			ranges |= 0x8000 >> (i / 16)
+		}
+	}
+	bw.writeBits(16, uint64(ranges))
+	for r := 0; r < 16; r++ {
+		if ranges&(0x8000>>r) == 0 {
+			continue
+		}
+		var bits uint16
+		for i := 0; i < 16; i++ {
+			if inUse[r*16+i] {
+				bits |= 0x8000 >> i
+			}
+		}
+		bw.writeBits(16, uint64(bits))
+	}
+
+	syms := bzMTF(bwt, unseqToSeq, numInUse)
+	alphaSize := numInUse + 2
+	freqs := make([]int, alphaSize)
+	for _, s := range syms {
+		freqs[s]++
+	}
+	lengths := bzCodeLengths(freqs)
+	codes := bzAssignCodes(lengths)
+
+	// Two identical tables are written because decoders require at least
+	// two; every selector picks the first.
+	numSelectors := (len(syms) + bzGroupSize - 1) / bzGroupSize
+	bw.writeBits(3, 2)
+	bw.writeBits(15, uint64(numSelectors))
+	for i := 0; i < numSelectors; i++ {
+		bw.writeBit(false)
+	}
+	for t := 0; t < 2; t++ {
+		cur := int(lengths[0])
+		bw.writeBits(5, uint64(cur))
+		for _, l := range lengths {
+			for cur < int(l) {
+				bw.writeBits(2, 2)
+				cur++
+			}
+			for cur > int(l) {
+				bw.writeBits(2, 3)
+				cur--
+			}
+			bw.writeBit(false)
+		}
+	}
+	for _, s := range syms {
+		bw.writeBits(uint(lengths[s]), uint64(codes[s]))
+	}
+}
+
+// bzTransform returns the Burrows-Wheeler transform of data and the index
+// of the original rotation among the sorted rotations. Rotations are
+// ranked by prefix doubling; each round only re-sorts the groups whose
+// prefixes are still tied.
+func bzTransform(data []byte) ([]byte, int) {
+	n := len(data)
+	idx := make([]int32, n)
+	rank := make([]int32, n)
+	tmp := make([]int32, n)
+
+	var counts [257]int32
+	for _, c := range data {
+		counts[int(c)+1]++
+	}
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+	next := counts
+	for i, c := range data {
+		idx[next[c]] = int32(i)
+		next[c]++
+		rank[i] = counts[c]
+	}
+
+	for k := 1; k < n; k <<= 1 {
+		second := func(i int32) int32 {
+			return rank[(int(i)+k)%n]
+		}
+		sorted := true
+		for start := 0; start < n; {
+			end := start + 1
+			for end < n && rank[idx[end]] == rank[idx[start]] {
+				end++
+			}
+			if end-start > 1 {
+				group := idx[start:end]
+				sort.Slice(group, func(a, b int) bool {
+					sa, sb := second(group[a]), second(group[b])
+					if sa != sb {
+						return sa < sb
+					}
+					return group[a] < group[b]
+				})
+			}
+			head := start
+			for j := start; j < end; j++ {
+				if j > start && second(idx[j]) != second(idx[j-1]) {
+					head = j
+				}
+				tmp[idx[j]] = int32(head)
+				if head != j {
+					sorted = false
+				}
+			}
+			start = end
+		}
+		copy(rank, tmp)
+		if sorted {
+			break
+		}
+	}
+
+	out := make([]byte, n)
+	origPtr := 0
+	for i, start := range idx {
+		if start == 0 {
+			origPtr = i
+		}
+		out[i] = data[(int(start)+n-1)%n]
+	}
+	return out, origPtr
+}
+
+// bzMTF applies move-to-front coding and zero-run encoding (RUNA/RUNB)
+// to the transformed block and appends the end-of-block symbol.
+func bzMTF(data []byte, unseqToSeq [256]byte, numInUse int) []uint16 {
+	var order [256]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+	var out []uint16
+	zeros := 0
+	flushZeros := func() {
+		if zeros == 0 {
+			return
+		}
+		zeros--
+		for {
+			out = append(out, uint16(zeros&1))
+			if zeros < 2 {
+				break
+			}
+			zeros = (zeros - 2) / 2
+		}
+		zeros = 0
+	}
+	for _, c := range data {
+		s := unseqToSeq[c]
+		j := 0
+		for order[j] != s {
+			j++
+		}
+		if j == 0 {
+			zeros++
+			continue
+		}
+		flushZeros()
+		copy(order[1:j+1], order[:j])
+		order[0] = s
+		out = append(out, uint16(j+1))
+	}
+	flushZeros()
+	return append(out, uint16(numInUse+1))
+}
+
+// bzCodeLengths builds Huffman code lengths no longer than bzMaxCodeLen,
+// flattening the frequencies until the limit is met as bzip2 does.
+func bzCodeLengths(freqs []int) []uint8 {
+	weights := make([]int, len(freqs))
+	for i, f := range freqs {
+		weights[i] = f
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+	for {
+		lengths := huffmanLengths(weights)
+		ok := true
+		for _, l := range lengths {
+			if l > bzMaxCodeLen {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return lengths
+		}
+		for i := range weights {
+			weights[i] = 1 + weights[i]/2
+		}
+	}
+}
+
+func huffmanLengths(weights []int) []uint8 {
+	type node struct {
+		weight      int
+		left, right int
+	}
+	nodes := make([]node, 0, 2*len(weights))
+	live := make([]int, 0, len(weights))
+	for _, w := range weights {
+		nodes = append(nodes, node{weight: w, left: -1, right: -1})
+		live = append(live, len(nodes)-1)
+	}
+	for len(live) > 1 {
+		sort.Slice(live, func(a, b int) bool {
+			return nodes[live[a]].weight < nodes[live[b]].weight
+		})
+		a, b := live[0], live[1]
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, left: a, right: b})
+		live = append(live[2:], len(nodes)-1)
+	}
+	lengths := make([]uint8, len(weights))
+	var walk func(n int, depth uint8)
+	walk = func(n int, depth uint8) {
+		if nodes[n].left < 0 {
+			if depth == 0 {
+				depth = 1
+			}
+			lengths[n] = depth
+			return
+		}
+		walk(nodes[n].left, depth+1)
+		walk(nodes[n].right, depth+1)
+	}
+	walk(live[0], 0)
+	return lengths
+}
+
+// bzAssignCodes assigns canonical codes: shorter codes first, ties broken
+// by symbol order.
+func bzAssignCodes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	code := uint32(0)
+	for l := uint8(1); l <= bzMaxCodeLen; l++ {
+		for i, sl := range lengths {
+			if sl == l {
+				codes[i] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
@@ -0,0 +1,711 @@
+package archiveutil
+
+import (
+	"errors"
+	"io"
+)
+
+// LZMA as used inside LZMA2 chunks. Only lc=3, lp=0, pb=2 are produced by
+// the encoder; the decoder accepts any valid properties.
+
+const (
+	lzmaStates          = 12
+	lzmaPosStatesMax    = 1 << 4
+	lzmaMatchMinLen     = 2
+	lzmaMatchMaxLen     = 273
+	lzmaEndPosModel     = 14
+	lzmaFullDistances   = 128
+	lzmaAlignBits       = 4
+	lzmaDistSlots       = 64
+	lzmaLenStates       = 4
+	lzmaProbInit        = 1024
+	lzmaProbBits        = 11
+	lzmaMoveBits        = 5
+	lzmaTopValue        = 1 << 24
+	lzmaLiteralCoderLen = 0x300
+)
+
+var errLZMACorrupt = errors.New("xz: corrupt LZMA2 data")
+
+type lzmaProb uint16
+
+type lzmaLenCoder struct {
+	choice  lzmaProb
+	choice2 lzmaProb
+	low     [lzmaPosStatesMax][1 << 3]lzmaProb
+	mid     [lzmaPosStatesMax][1 << 3]lzmaProb
+	high    [1 << 8]lzmaProb
+}
+
+// lzmaModel holds the adaptive probabilities and coder state shared by
+// the encoder and decoder.
+type lzmaModel struct {
+	lc, lp, pb int
+
+	state int
+	reps  [4]int
+
+	literal    []lzmaProb
+	isMatch    [lzmaStates][lzmaPosStatesMax]lzmaProb
+	isRep      [lzmaStates]lzmaProb
+	isRepG0    [lzmaStates]lzmaProb
+	isRepG1    [lzmaStates]lzmaProb
+	isRepG2    [lzmaStates]lzmaProb
+	isRep0Long [lzmaStates][lzmaPosStatesMax]lzmaProb
+	distSlot   [lzmaLenStates][lzmaDistSlots]lzmaProb
+	distSpec   [lzmaFullDistances - lzmaEndPosModel + 1]lzmaProb
+	align      [1 << lzmaAlignBits]lzmaProb
+	matchLen   lzmaLenCoder
+	repLen     lzmaLenCoder
+}
+
+// setProps decodes an LZMA properties byte.
+func (m *lzmaModel) setProps(props byte) error {
+	if props > (4*5+4)*9+8 {
+		return errLZMACorrupt
+	}
+	m.lc = int(props % 9)
+	props /= 9
+	m.lp = int(props % 5)
+	m.pb = int(props / 5)
+	if m.lc+m.lp > 4 {
+		return errLZMACorrupt
+	}
+	return nil
+}
+
+func (m *lzmaModel) reset() {
+	m.state = 0
+	m.reps = [4]int{}
+	size := lzmaLiteralCoderLen << (m.lc + m.lp)
+	if cap(m.literal) < size {
+		m.literal = make([]lzmaProb, size)
+	}
+	m.literal = m.literal[:size]
+	fill := func(p []lzmaProb) {
+		for i := range p {
+			p[i] = lzmaProbInit
+		}
+	}
+	fill(m.literal)
+	for s := 0; s < lzmaStates; s++ {
+		fill(m.isMatch[s][:])
+		fill(m.isRep0Long[s][:])
+	}
+	fill(m.isRep[:])
+	fill(m.isRepG0[:])
+	fill(m.isRepG1[:])
+	fill(m.isRepG2[:])
+	for s := range m.distSlot {
+		fill(m.distSlot[s][:])
+	}
+	fill(m.distSpec[:])
+	fill(m.align[:])
+	for _, lc := range []*lzmaLenCoder{&m.matchLen, &m.repLen} {
+		lc.choice, lc.choice2 = lzmaProbInit, lzmaProbInit
+		for p := range lc.low {
+			fill(lc.low[p][:])
+			fill(lc.mid[p][:])
+		}
+		fill(lc.high[:])
+	}
+}
+
+// literalProbs returns the literal coder selected by position and the
+// previous byte.
+func (m *lzmaModel) literalProbs(pos int64, prev byte) []lzmaProb {
+	lit := int(pos)&(1<<m.lp-1)<<m.lc + int(prev)>>(8-m.lc)
+	return m.literal[lit*lzmaLiteralCoderLen : (lit+1)*lzmaLiteralCoderLen]
+}
+
+func (m *lzmaModel) updateLiteral() {
+	switch {
+	case m.state < 4:
+		m.state = 0
+	case m.state < 10:
+		m.state -= 3
+	default:
+		m.state -= 6
+	}
+}
+
+func (m *lzmaModel) updateMatch() {
+	if m.state < 7 {
+		m.state = 7
+	} else {
+		m.state = 10
+	}
+}
+
+func (m *lzmaModel) updateRep() {
+	if m.state < 7 {
+		m.state = 8
+	} else {
+		m.state = 11
+	}
+}
+
+func (m *lzmaModel) updateShortRep() {
+	if m.state < 7 {
+		m.state = 9
+	} else {
+		m.state = 11
+	}
+}
+
+func lenToDistState(length int) int {
+	if length-lzmaMatchMinLen < lzmaLenStates {
+		return length - lzmaMatchMinLen
+	}
+	return lzmaLenStates - 1
+}
+
+// lzmaWindow is the decoder's circular dictionary. Bytes are passed to w
+// as the buffer fills and at the end of each chunk.
+type lzmaWindow struct {
+	buf     []byte
+	pos     int
+	full    bool
+	flushed int
+	total   int64 // bytes since the last dictionary reset
+	w       io.Writer
+}
+
+func (d *lzmaWindow) reset() {
+	d.pos, d.flushed, d.full, d.total = 0, 0, false, 0
+}
+
+func (d *lzmaWindow) put(b byte) error {
+	d.buf[d.pos] = b
+	d.pos++
+	d.total++
+	if d.pos == len(d.buf) {
+		if err := d.flush(); err != nil {
+			return err
+		}
+		d.pos, d.flushed, d.full = 0, 0, true
+	}
+	return nil
+}
+
+// get returns the byte dist+1 positions back.
+func (d *lzmaWindow) get(dist int) byte {
+	i := d.pos - dist - 1
+	if i < 0 {
+		i += len(d.buf)
+	}
+	return d.buf[i]
+}
+
+func (d *lzmaWindow) has(dist int) bool {
+	return int64(dist) < d.total && dist < len(d.buf) && (d.full || dist < d.pos)
+}
+
+func (d *lzmaWindow) flush() error {
+	if d.flushed < d.pos {
+		if _, err := d.w.Write(d.buf[d.flushed:d.pos]); err != nil {
+			return err
+		}
+		d.flushed = d.pos
+	}
+	return nil
+}
+
+type rangeDecoder struct {
+	data  []byte
+	pos   int
+	rng   uint32
+	code  uint32
+	nread bool
+}
+
+func (rc *rangeDecoder) init(data []byte) error {
+	if len(data) < 5 || data[0] != 0 {
+		return errLZMACorrupt
+	}
+	rc.data = data
+	rc.pos = 5
+	rc.rng = 0xffffffff
+	rc.code = uint32(data[1])<<24 | uint32(data[2])<<16 | uint32(data[3])<<8 | uint32(data[4])
+	return nil
+}
+
+func (rc *rangeDecoder) normalize() {
+	if rc.rng < lzmaTopValue {
+		rc.rng <<= 8
+		var b byte
+		if rc.pos < len(rc.data) {
+			b = rc.data[rc.pos]
+		} else {
+			rc.nread = true
+		}
+		rc.pos++
+		rc.code = rc.code<<8 | uint32(b)
+	}
+}
+
+func (rc *rangeDecoder) bit(p *lzmaProb) int {
+	bound := (rc.rng >> lzmaProbBits) * uint32(*p)
+	var bit int
+	if rc.code < bound {
+		rc.rng = bound
+		*p += (1<<lzmaProbBits - *p) >> lzmaMoveBits
+	} else {
+		rc.rng -= bound
+		rc.code -= bound
+		*p -= *p >> lzmaMoveBits
+		bit = 1
+	}
+	rc.normalize()
+	return bit
+}
+
+func (rc *rangeDecoder) direct(n int) int {
+	v := 0
+	for ; n > 0; n-- {
+		rc.rng >>= 1
+		bit := 0
+		if rc.code >= rc.rng {
+			rc.code -= rc.rng
+			bit = 1
+		}
+		v = v<<1 | bit
+		rc.normalize()
+	}
+	return v
+}
+
+func (rc *rangeDecoder) tree(probs []lzmaProb, bits int) int {
+	m := 1
+	for i := 0; i < bits; i++ {
+		m = m<<1 | rc.bit(&probs[m])
+	}
+	return m - 1<<bits
+}
+
+func (rc *rangeDecoder) reverseTree(probs []lzmaProb, bits int) int {
+	m, sym := 1, 0
+	for i := 0; i < bits; i++ {
+		bit := rc.bit(&probs[m])
+		m = m<<1 | bit
+		sym |= bit << i
+	}
+	return sym
+}
+
+func (rc *rangeDecoder) length(lc *lzmaLenCoder, posState int) int {
+	if rc.bit(&lc.choice) == 0 {
+		return lzmaMatchMinLen + rc.tree(lc.low[posState][:], 3)
+	}
+	if rc.bit(&lc.choice2) == 0 {
+		return lzmaMatchMinLen + 8 + rc.tree(lc.mid[posState][:], 3)
+	}
+	return lzmaMatchMinLen + 16 + rc.tree(lc.high[:], 8)
+}
+
+// decodeChunk decodes one LZMA chunk producing exactly size bytes.
+func (m *lzmaModel) decodeChunk(rc *rangeDecoder, win *lzmaWindow, size int) error {
+	posMask := 1<<m.pb - 1
+	for size > 0 {
+		posState := int(win.total) & posMask
+		if rc.bit(&m.isMatch[m.state][posState]) == 0 {
+			var prev byte
+			if win.total > 0 {
+				prev = win.get(0)
+			}
+			probs := m.literalProbs(win.total, prev)
+			sym := 1
+			if m.state >= 7 {
+				if !win.has(m.reps[0]) {
+					return errLZMACorrupt
+				}
+				match := int(win.get(m.reps[0]))
+				for sym < 0x100 {
+					matchBit := match >> 7 & 1
+					match <<= 1
+					bit := rc.bit(&probs[(1+matchBit)<<8+sym])
+					sym = sym<<1 | bit
+					if matchBit != bit {
+						break
+					}
+				}
+			}
+			for sym < 0x100 {
+				sym = sym<<1 | rc.bit(&probs[sym])
+			}
+			if err := win.put(byte(sym)); err != nil {
+				return err
+			}
+			m.updateLiteral()
+			size--
+			continue
+		}
+
+		var length int
+		if rc.bit(&m.isRep[m.state]) == 0 {
+			length = rc.length(&m.matchLen, posState)
+			dist := m.decodeDistance(rc, length)
+			if dist == 0xffffffff {
+				return errLZMACorrupt
+			}
+			m.reps[3], m.reps[2], m.reps[1], m.reps[0] = m.reps[2], m.reps[1], m.reps[0], dist
+			m.updateMatch()
+		} else {
+			if rc.bit(&m.isRepG0[m.state]) == 0 {
+				if rc.bit(&m.isRep0Long[m.state][posState]) == 0 {
+					if !win.has(m.reps[0]) {
+						return errLZMACorrupt
+					}
+					m.updateShortRep()
+					if err := win.put(win.get(m.reps[0])); err != nil {
+						return err
+					}
+					size--
+					continue
+				}
+			} else {
+				var dist int
+				if rc.bit(&m.isRepG1[m.state]) == 0 {
+					dist = m.reps[1]
+				} else {
+					if rc.bit(&m.isRepG2[m.state]) == 0 {
+						dist = m.reps[2]
+					} else {
+						dist = m.reps[3]
+						m.reps[3] = m.reps[2]
+					}
+					m.reps[2] = m.reps[1]
+				}
+				m.reps[1] = m.reps[0]
+				m.reps[0] = dist
+			}
+			length = rc.length(&m.repLen, posState)
+			m.updateRep()
+		}
+		if length > size || !win.has(m.reps[0]) {
+			return errLZMACorrupt
+		}
+		for i := 0; i < length; i++ {
+			if err := win.put(win.get(m.reps[0])); err != nil {
+				return err
+			}
+		}
+		size -= length
+	}
+	if rc.nread {
+		return errLZMACorrupt
+	}
+	return nil
+}
+
+func (m *lzmaModel) decodeDistance(rc *rangeDecoder, length int) int {
+	slot := rc.tree(m.distSlot[lenToDistState(length)][:], 6)
+	if slot < 4 {
+		return slot
+	}
+	direct := slot>>1 - 1
+	dist := (2 | slot&1) << direct
+	if slot < lzmaEndPosModel {
+		return dist + rc.reverseTree(m.distSpec[dist-slot:], direct)
+	}
+	dist += rc.direct(direct-lzmaAlignBits) << lzmaAlignBits
+	return dist + rc.reverseTree(m.align[:], lzmaAlignBits)
+}
+
+type rangeEncoder struct {
+	out       []byte
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+}
+
+func (rc *rangeEncoder) reset() {
+	rc.out = rc.out[:0]
+	rc.low = 0
+	rc.rng = 0xffffffff
+	rc.cache = 0
+	rc.cacheSize = 1
+}
+
+func (rc *rangeEncoder) shiftLow() {
+	if uint32(rc.low) < 0xff000000 || rc.low>>32 != 0 {
+		carry := byte(rc.low >> 32)
+		temp := rc.cache
+		for {
+			rc.out = append(rc.out, temp+carry)
+			temp = 0xff
+			rc.cacheSize--
+			if rc.cacheSize == 0 {
+				break
+			}
+		}
+		rc.cache = byte(rc.low >> 24)
+	}
+	rc.cacheSize++
+	rc.low = uint64(uint32(rc.low) << 8)
+}
+
+// pending is an upper bound on the bytes the encoder will emit if
+// flushed now.
+func (rc *rangeEncoder) pending() int {
+	return len(rc.out) + rc.cacheSize + 5
+}
+
+func (rc *rangeEncoder) bit(p *lzmaProb, bit int) {
+	bound := (rc.rng >> lzmaProbBits) * uint32(*p)
+	if bit == 0 {
+		rc.rng = bound
+		*p += (1<<lzmaProbBits - *p) >> lzmaMoveBits
+	} else {
+		rc.low += uint64(bound)
+		rc.rng -= bound
+		*p -= *p >> lzmaMoveBits
+	}
+	for rc.rng < lzmaTopValue {
+		rc.rng <<= 8
+		rc.shiftLow()
+	}
+}
+
+func (rc *rangeEncoder) direct(v, n int) {
+	for n--; n >= 0; n-- {
+		rc.rng >>= 1
+		if v>>n&1 != 0 {
+			rc.low += uint64(rc.rng)
+		}
+		for rc.rng < lzmaTopValue {
+			rc.rng <<= 8
+			rc.shiftLow()
+		}
+	}
+}
+
+func (rc *rangeEncoder) flush() {
+	for i := 0; i < 5; i++ {
+		rc.shiftLow()
+	}
+}
+
+func (rc *rangeEncoder) tree(probs []lzmaProb, bits, sym int) {
+	m := 1
+	for i := bits - 1; i >= 0; i-- {
+		bit := sym >> i & 1
+		rc.bit(&probs[m], bit)
+		m = m<<1 | bit
+	}
+}
+
+func (rc *rangeEncoder) reverseTree(probs []lzmaProb, bits, sym int) {
+	m := 1
+	for i := 0; i < bits; i++ {
+		bit := sym & 1
+		sym >>= 1
+		rc.bit(&probs[m], bit)
+		m = m<<1 | bit
+	}
+}
+
+func (rc *rangeEncoder) length(lc *lzmaLenCoder, length, posState int) {
+	length -= lzmaMatchMinLen
+	switch {
+	case length < 8:
+		rc.bit(&lc.choice, 0)
+		rc.tree(lc.low[posState][:], 3, length)
+	case length < 16:
+		rc.bit(&lc.choice, 1)
+		rc.bit(&lc.choice2, 0)
+		rc.tree(lc.mid[posState][:], 3, length-8)
+	default:
+		rc.bit(&lc.choice, 1)
+		rc.bit(&lc.choice2, 1)
+		rc.tree(lc.high[:], 8, length-16)
+	}
+}
+
+// lzmaEncoder compresses one dictionary's worth of data with a greedy
+// hash-chain match finder.
+type lzmaEncoder struct {
+	lzmaModel
+	rc    rangeEncoder
+	data  []byte
+	head  []int32
+	chain []int32
+	depth int
+}
+
+const lzmaHashBits = 16
+
+func newLZMAEncoder(depth int) *lzmaEncoder {
+	e := &lzmaEncoder{depth: depth, head: make([]int32, 1<<lzmaHashBits)}
+	e.lc, e.lp, e.pb = 3, 0, 2
+	return e
+}
+
+// props returns the LZMA properties byte for the encoder's settings.
+func (e *lzmaEncoder) props() byte {
+	return byte((e.pb*5+e.lp)*9 + e.lc)
+}
+
+func lzmaHash(b []byte) int {
+	return int((uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) * 2654435761 >> (32 - lzmaHashBits))
+}
+
+// start resets the encoder for a new, independent dictionary.
+func (e *lzmaEncoder) start(data []byte) {
+	e.data = data
+	for i := range e.head {
+		e.head[i] = -1
+	}
+	if cap(e.chain) < len(data) {
+		e.chain = make([]int32, len(data))
+	}
+	e.chain = e.chain[:len(data)]
+	e.reset()
+}
+
+func (e *lzmaEncoder) insert(pos int) {
+	if pos+3 > len(e.data) {
+		return
+	}
+	h := lzmaHash(e.data[pos:])
+	e.chain[pos] = e.head[h]
+	e.head[h] = int32(pos)
+}
+
+func (e *lzmaEncoder) matchLength(pos, dist, limit int) int {
+	src := pos - dist - 1
+	if src < 0 {
+		return 0
+	}
+	n := 0
+	for n < limit && e.data[pos+n] == e.data[src+n] {
+		n++
+	}
+	return n
+}
+
+// findMatch returns the longest earlier match at pos as a zero-based
+// distance and length.
+func (e *lzmaEncoder) findMatch(pos, limit int) (int, int) {
+	if pos+3 > len(e.data) {
+		return 0, 0
+	}
+	bestLen, bestDist := 0, 0
+	cand := e.head[lzmaHash(e.data[pos:])]
+	for i := 0; i < e.depth && cand >= 0; i++ {
+		dist := pos - int(cand) - 1
+		if n := e.matchLength(pos, dist, limit); n > bestLen {
+			bestLen, bestDist = n, dist
+			if n == limit {
+				break
+			}
+		}
+		cand = e.chain[cand]
+	}
+	return bestDist, bestLen
+}
+
+// encodeChunk encodes data from pos until either limit bytes have been
+// consumed or the compressed output approaches the LZMA2 chunk size cap.
+// It returns the number of input bytes consumed; the compressed bytes are
+// left in e.rc.out.
+func (e *lzmaEncoder) encodeChunk(pos, limit, maxPacked int) int {
+	e.rc.reset()
+	posMask := 1<<e.pb - 1
+	start := pos
+	end := pos + limit
+	for pos < end && e.rc.pending() < maxPacked {
+		posState := pos & posMask
+		avail := end - pos
+		if avail > lzmaMatchMaxLen {
+			avail = lzmaMatchMaxLen
+		}
+		repLen := 0
+		if pos > e.reps[0] {
+			repLen = e.matchLength(pos, e.reps[0], avail)
+		}
+		dist, length := e.findMatch(pos, avail)
+
+		switch {
+		case repLen >= lzmaMatchMinLen && repLen+1 >= length:
+			e.rc.bit(&e.isMatch[e.state][posState], 1)
+			e.rc.bit(&e.isRep[e.state], 1)
+			e.rc.bit(&e.isRepG0[e.state], 0)
+			e.rc.bit(&e.isRep0Long[e.state][posState], 1)
+			e.rc.length(&e.repLen, repLen, posState)
+			e.updateRep()
+			length = repLen
+		case length >= 3:
+			e.rc.bit(&e.isMatch[e.state][posState], 1)
+			e.rc.bit(&e.isRep[e.state], 0)
+			e.rc.length(&e.matchLen, length, posState)
+			e.encodeDistance(dist, length)
+			e.reps[3], e.reps[2], e.reps[1], e.reps[0] = e.reps[2], e.reps[1], e.reps[0], dist
+			e.updateMatch()
+		default:
+			e.rc.bit(&e.isMatch[e.state][posState], 0)
+			e.encodeLiteral(pos)
+			e.updateLiteral()
+			length = 1
+		}
+		for i := 0; i < length; i++ {
+			e.insert(pos + i)
+		}
+		pos += length
+	}
+	e.rc.flush()
+	return pos - start
+}
+
+func (e *lzmaEncoder) encodeLiteral(pos int) {
+	var prev byte
+	if pos > 0 {
+		prev = e.data[pos-1]
+	}
+	probs := e.literalProbs(int64(pos), prev)
+	b := int(e.data[pos])
+	sym := 1
+	i := 7
+	if e.state >= 7 {
+		match := int(e.data[pos-e.reps[0]-1])
+		for ; i >= 0; i-- {
+			bit := b >> i & 1
+			matchBit := match >> i & 1
+			e.rc.bit(&probs[(1+matchBit)<<8+sym], bit)
+			sym = sym<<1 | bit
+			if matchBit != bit {
+				i--
+				break
+			}
+		}
+	}
+	for ; i >= 0; i-- {
+		bit := b >> i & 1
+		e.rc.bit(&probs[sym], bit)
+		sym = sym<<1 | bit
+	}
+}
+
+func (e *lzmaEncoder) encodeDistance(dist, length int) {
+	probs := e.distSlot[lenToDistState(length)][:]
+	if dist < 4 {
+		e.rc.tree(probs, 6, dist)
+		return
+	}
+	top := 31
+	for dist>>top == 0 {
+		top--
+	}
+	slot := top<<1 | dist>>(top-1)&1
+	e.rc.tree(probs, 6, slot)
+	direct := slot>>1 - 1
+	base := (2 | slot&1) << direct
+	reduced := dist - base
+	if slot < lzmaEndPosModel {
+		e.rc.reverseTree(e.distSpec[base-slot:], direct, reduced)
+		return
+	}
+	e.rc.direct(reduced>>lzmaAlignBits, direct-lzmaAlignBits)
+	e.rc.reverseTree(e.align[:], lzmaAlignBits, reduced&(1<<lzmaAlignBits-1))
+}
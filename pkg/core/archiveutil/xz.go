@@ -0,0 +1,531 @@
+package archiveutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+// The xz container (https://tukaani.org/xz/xz-file-format.txt) with the
+// LZMA2 filter. Other filters are rejected when reading.
+
+var (
+	xzMagic       = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	xzFooterMagic = []byte{'Y', 'Z'}
+	crc64Table    = crc64.MakeTable(crc64.ECMA)
+)
+
+const (
+	xzCheckNone   = 0x00
+	xzCheckCRC32  = 0x01
+	xzCheckCRC64  = 0x04
+	xzCheckSHA256 = 0x0a
+	xzFilterLZMA2 = 0x21
+
+	// xzDictProp selects a 4 MiB dictionary (2^(20/2+12)).
+	xzDictProp = 20
+	xzDictSize = 1 << 22
+
+	lzma2MaxUnpacked = 1 << 21
+	lzma2MaxPacked   = 1 << 16
+
+	// xzMaxDict bounds the dictionary the reader will allocate.
+	xzMaxDict = 1 << 26
+)
+
+var errXZCorrupt = errors.New("xz: corrupt data")
+
+// xzWriter compresses data written to it as a single-stream .xz file.
+// Input is buffered and encoded as one block per dictionary.
+type xzWriter struct {
+	w       io.Writer
+	buf     []byte
+	enc     *lzmaEncoder
+	records [][2]uint64
+	started bool
+	closed  bool
+	err     error
+}
+
+// NewXZWriter returns a writer that compresses to w in xz format using
+// the LZMA2 filter and a CRC64 check.
+func NewXZWriter(w io.Writer) io.WriteCloser {
+	return &xzWriter{w: w, enc: newLZMAEncoder(32)}
+}
+
+func (z *xzWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("xz: write after close")
+	}
+	n := len(p)
+	for len(p) > 0 && z.err == nil {
+		take := xzDictSize - len(z.buf)
+		if take > len(p) {
+			take = len(p)
+		}
+		z.buf = append(z.buf, p[:take]...)
+		p = p[take:]
+		if len(z.buf) == xzDictSize {
+			z.writeBlock()
+		}
+	}
+	return n, z.err
+}
+
+func (z *xzWriter) Close() error {
+	if z.closed {
+		return z.err
+	}
+	z.closed = true
+	if len(z.buf) > 0 {
+		z.writeBlock()
+	}
+	z.writeHeader()
+	z.writeIndexAndFooter()
+	return z.err
+}
+
+func (z *xzWriter) write(p []byte) {
+	if z.err == nil {
+		_, z.err = z.w.Write(p)
+	}
+}
+
+func (z *xzWriter) writeHeader() {
+	if z.started {
+		return
+	}
+	z.started = true
+	flags := []byte{0x00, xzCheckCRC64}
+	z.write(xzMagic)
+	z.write(flags)
+	z.write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(flags)))
+}
+
+func (z *xzWriter) writeBlock() {
+	z.writeHeader()
+	data := z.buf
+	z.buf = z.buf[:0]
+
+	header := []byte{0x02, 0x00, xzFilterLZMA2, 0x01, xzDictProp, 0x00, 0x00, 0x00}
+	header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE(header))
+	z.write(header)
+
+	z.enc.start(data)
+	var packed uint64
+	for pos, first := 0, true; pos < len(data); first = false {
+		limit := len(data) - pos
+		if limit > lzma2MaxUnpacked {
+			limit = lzma2MaxUnpacked
+		}
+		n := z.enc.encodeChunk(pos, limit, lzma2MaxPacked-1024)
+		out := z.enc.rc.out
+		control := byte(0x80)
+		if first {
+			control = 0xe0 // dictionary reset, new properties, state reset
+		}
+		chunk := []byte{
+			control | byte((n-1)>>16),
+			byte((n - 1) >> 8), byte(n - 1),
+			byte((len(out) - 1) >> 8), byte(len(out) - 1),
+		}
+		if first {
+			chunk = append(chunk, z.enc.props())
+		}
+		z.write(chunk)
+		z.write(out)
+		packed += uint64(len(chunk) + len(out))
+		pos += n
+	}
+	z.write([]byte{0x00})
+	packed++
+	if pad := (4 - packed%4) % 4; pad > 0 {
+		z.write(make([]byte, pad))
+	}
+	z.write(binary.LittleEndian.AppendUint64(nil, crc64.Checksum(data, crc64Table)))
+	z.records = append(z.records, [2]uint64{uint64(len(header)) + packed + 8, uint64(len(data))})
+}
+
+func (z *xzWriter) writeIndexAndFooter() {
+	index := []byte{0x00}
+	index = appendXZVarint(index, uint64(len(z.records)))
+	for _, r := range z.records {
+		index = appendXZVarint(index, r[0])
+		index = appendXZVarint(index, r[1])
+	}
+	for len(index)%4 != 0 {
+		index = append(index, 0)
+	}
+	index = binary.LittleEndian.AppendUint32(index, crc32.ChecksumIEEE(index))
+	z.write(index)
+
+	footer := binary.LittleEndian.AppendUint32(nil, uint32(len(index)/4-1))
+	footer = append(footer, 0x00, xzCheckCRC64)
+	z.write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(footer)))
+	z.write(footer)
+	z.write(xzFooterMagic)
+}
+
+func appendXZVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// NewXZReader returns a reader that decompresses the xz data in r.
+// Concatenated streams and stream padding are accepted.
+func NewXZReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(decodeXZ(bufio.NewReader(r), pw))
+	}()
+	return pr
+}
+
+func decodeXZ(r *bufio.Reader, w io.Writer) error {
+	for streams := 0; ; streams++ {
+		if streams > 0 {
+			// Skip stream padding; stop cleanly at EOF.
+			for {
+				b, err := r.Peek(4)
+				if err == io.EOF && len(b) == 0 {
+					return nil
+				}
+				if err != nil {
+					return errXZCorrupt
+				}
+				if !bytes.Equal(b, []byte{0, 0, 0, 0}) {
+					break
+				}
+				_, _ = r.Discard(4)
+			}
+		}
+		if err := decodeXZStream(r, w); err != nil {
+			return err
+		}
+	}
+}
+
+func decodeXZStream(r *bufio.Reader, w io.Writer) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return errXZCorrupt
+	}
+	if !bytes.Equal(header[:6], xzMagic) || header[6] != 0 ||
+		crc32.ChecksumIEEE(header[6:8]) != binary.LittleEndian.Uint32(header[8:]) {
+		return errors.New("xz: not an xz stream")
+	}
+	check := header[7]
+	var win lzmaWindow
+	var model lzmaModel
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return errXZCorrupt
+		}
+		if size == 0 {
+			break // index follows
+		}
+		if err := decodeXZBlock(r, w, int(size), check, &win, &model); err != nil {
+			return err
+		}
+	}
+	return skipXZIndexAndFooter(r)
+}
+
+func newXZCheck(check byte) (hash.Hash, int, error) {
+	switch check {
+	case xzCheckNone:
+		return nil, 0, nil
+	case xzCheckCRC32:
+		return crc32.NewIEEE(), 4, nil
+	case xzCheckCRC64:
+		return crc64.New(crc64Table), 8, nil
+	case xzCheckSHA256:
+		return sha256.New(), 32, nil
+	}
+	return nil, 0, errors.New("xz: unsupported integrity check")
+}
+
+func decodeXZBlock(r *bufio.Reader, w io.Writer, sizeByte int, check byte, win *lzmaWindow, model *lzmaModel) error {
+	hdrLen := (sizeByte + 1) * 4
+	hdr := make([]byte, hdrLen)
+	hdr[0] = byte(sizeByte)
+	if _, err := io.ReadFull(r, hdr[1:]); err != nil {
+		return errXZCorrupt
+	}
+	if crc32.ChecksumIEEE(hdr[:hdrLen-4]) != binary.LittleEndian.Uint32(hdr[hdrLen-4:]) {
+		return errXZCorrupt
+	}
+	flags := hdr[1]
+	if flags&0x3c != 0 {
+		return errXZCorrupt
+	}
+	p := hdr[2 : hdrLen-4]
+	next := func() (uint64, error) {
+		var v uint64
+		for i := 0; i < 9 && len(p) > 0; i++ {
+			b := p[0]
+			p = p[1:]
+			v |= uint64(b&0x7f) << (7 * i)
+			if b&0x80 == 0 {
+				return v, nil
+			}
+		}
+		return 0, errXZCorrupt
+	}
+	if flags&0x40 != 0 {
+		if _, err := next(); err != nil {
+			return err
+		}
+	}
+	if flags&0x80 != 0 {
+		if _, err := next(); err != nil {
+			return err
+		}
+	}
+	if flags&0x03 != 0 {
+		return errors.New("xz: unsupported filter chain")
+	}
+	id, err := next()
+	if err != nil {
+		return err
+	}
+	propLen, err := next()
+	if err != nil {
+		return err
+	}
+	if id != xzFilterLZMA2 || propLen != 1 || len(p) < 1 {
+		return errors.New("xz: unsupported filter")
+	}
+	dictSize, err := lzma2DictSize(p[0])
+	if err != nil {
+		return err
+	}
+	if dictSize > xzMaxDict {
+		return errors.New("xz: dictionary too large")
+	}
+	if len(win.buf) < dictSize {
+		win.buf = make([]byte, dictSize)
+	}
+	win.reset()
+
+	sum, sumLen, err := newXZCheck(check)
+	if err != nil {
+		return err
+	}
+	out := w
+	if sum != nil {
+		out = io.MultiWriter(w, sum)
+	}
+	win.w = out
+	counted := &countingReader{r: r}
+	if err := decodeLZMA2(counted, win, model); err != nil {
+		return err
+	}
+	if pad := (4 - (int64(hdrLen)+counted.n)%4) % 4; pad > 0 {
+		if _, err := r.Discard(int(pad)); err != nil {
+			return errXZCorrupt
+		}
+	}
+	want := make([]byte, sumLen)
+	if _, err := io.ReadFull(r, want); err != nil {
+		return errXZCorrupt
+	}
+	if sum != nil && !bytes.Equal(sum.Sum(nil), reverseIfLE(check, want)) {
+		return errors.New("xz: checksum mismatch")
+	}
+	return nil
+}
+
+// reverseIfLE converts a stored little-endian CRC to the big-endian form
+// returned by hash.Hash.Sum.
+func reverseIfLE(check byte, b []byte) []byte {
+	if check != xzCheckCRC32 && check != xzCheckCRC64 {
+		return b
+	}
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[len(b)-1-i]
+	}
+	return out
+}
+
+func lzma2DictSize(prop byte) (int, error) {
+	if prop > 40 {
+		return 0, errXZCorrupt
+	}
+	if prop == 40 {
+		return 0xffffffff, nil
+	}
+	return (2 | int(prop)&1) << (prop/2 + 11), nil
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(c.r, p)
+	c.n += int64(n)
+	return n, err
+}
+
+func decodeLZMA2(r *countingReader, win *lzmaWindow, model *lzmaModel) error {
+	needDictReset := true
+	needProps := true
+	packed := make([]byte, lzma2MaxPacked)
+	for {
+		control, err := r.ReadByte()
+		if err != nil {
+			return errXZCorrupt
+		}
+		if control == 0x00 {
+			return win.flush()
+		}
+		if control == 0x01 || control == 0x02 {
+			if control == 0x01 {
+				if err := win.flush(); err != nil {
+					return err
+				}
+				win.reset()
+				needDictReset = false
+			} else if needDictReset {
+				return errXZCorrupt
+			}
+			var sz [2]byte
+			if _, err := r.Read(sz[:]); err != nil {
+				return errXZCorrupt
+			}
+			n := int(binary.BigEndian.Uint16(sz[:])) + 1
+			data := packed[:n]
+			if _, err := r.Read(data); err != nil {
+				return errXZCorrupt
+			}
+			for _, b := range data {
+				if err := win.put(b); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if control < 0x80 {
+			return errXZCorrupt
+		}
+		var sz [4]byte
+		if _, err := r.Read(sz[:]); err != nil {
+			return errXZCorrupt
+		}
+		unpacked := int(control&0x1f)<<16 + int(binary.BigEndian.Uint16(sz[:2])) + 1
+		packedLen := int(binary.BigEndian.Uint16(sz[2:])) + 1
+		reset := control >> 5 & 0x03
+		if reset == 3 {
+			if err := win.flush(); err != nil {
+				return err
+			}
+			win.reset()
+			needDictReset = false
+		} else if needDictReset {
+			return errXZCorrupt
+		}
+		if reset >= 2 {
+			props, err := r.ReadByte()
+			if err != nil {
+				return errXZCorrupt
+			}
+			if err := model.setProps(props); err != nil {
+				return err
+			}
+			needProps = false
+		} else if needProps {
+			return errXZCorrupt
+		}
+		if reset >= 1 {
+			model.reset()
+		}
+		data := packed[:packedLen]
+		if _, err := r.Read(data); err != nil {
+			return errXZCorrupt
+		}
+		var rc rangeDecoder
+		if err := rc.init(data); err != nil {
+			return err
+		}
+		if err := model.decodeChunk(&rc, win, unpacked); err != nil {
+			return err
+		}
+		if err := win.flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// skipXZIndexAndFooter verifies the index CRC and the stream footer. The
+// index indicator byte has already been consumed.
+func skipXZIndexAndFooter(r *bufio.Reader) error {
+	h := crc32.NewIEEE()
+	h.Write([]byte{0x00})
+	size := 1
+	readVarint := func() (uint64, error) {
+		var v uint64
+		for i := 0; i < 9; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, errXZCorrupt
+			}
+			h.Write([]byte{b})
+			size++
+			v |= uint64(b&0x7f) << (7 * i)
+			if b&0x80 == 0 {
+				return v, nil
+			}
+		}
+		return 0, errXZCorrupt
+	}
+	count, err := readVarint()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < 2*count; i++ {
+		if _, err := readVarint(); err != nil {
+			return err
+		}
+	}
+	pad := make([]byte, (4-size%4)%4)
+	if _, err := io.ReadFull(r, pad); err != nil {
+		return errXZCorrupt
+	}
+	h.Write(pad)
+	var crc [4]byte
+	if _, err := io.ReadFull(r, crc[:]); err != nil {
+		return errXZCorrupt
+	}
+	if h.Sum32() != binary.LittleEndian.Uint32(crc[:]) {
+		return errXZCorrupt
+	}
+	footer := make([]byte, 12)
+	if _, err := io.ReadFull(r, footer); err != nil {
+		return errXZCorrupt
+	}
+	if !bytes.Equal(footer[10:], xzFooterMagic) {
+		return errXZCorrupt
+	}
+	return nil
+}
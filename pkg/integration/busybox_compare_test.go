@@ -160,6 +160,10 @@ func TestBusyboxComparisons(t *testing.T) {
 			if tt.applet == "find" {
 				busyOut = strings.ReplaceAll(busyOut, "./", "")
 			}
+			if tt.applet == "diff" {
+				ourOut = testutil.NormalizeDiffOutput(ourOut)
+				busyOut = testutil.NormalizeDiffOutput(busyOut)
+			}
 			if tt.applet == "taskset" {
 				ourOut = scrubTasksetPID(ourOut)
 				busyOut = scrubTasksetPID(busyOut)
@@ -136,6 +136,20 @@ func NormalizePsOutput(out string) string {
 	return strings.Join(filtered, "\n")
 }
 
+// NormalizeDiffOutput strips the tab-separated timestamps from unified
+// diff ---/+++ header lines, which differ between otherwise identical runs.
+func NormalizeDiffOutput(out string) string {
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+			if idx := strings.IndexByte(line, '\t'); idx >= 0 {
+				lines[i] = line[:idx]
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // CompareBusyboxOutput compares our applet output against the reference
 // busybox binary and reports mismatches as test failures.
 func CompareBusyboxOutput(t *testing.T, applet string, ourOut, ourErr string, ourCode int, busyOut, busyErr string, busyCode int) {
@@ -148,6 +162,10 @@ func CompareBusyboxOutput(t *testing.T, applet string, ourOut, ourErr string, ou
 	if applet == "find" {
 		busyOut = strings.ReplaceAll(busyOut, "./", "")
 	}
+	if applet == "diff" {
+		ourOut = NormalizeDiffOutput(ourOut)
+		busyOut = NormalizeDiffOutput(busyOut)
+	}
 	if ourCode != busyCode {
 		if busyCode == 1 && ourCode == 2 && (isUsageError(ourErr) || isUsageError(busyErr)) {
 			return
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package testutil
+
+import (
+	"os"
+	"testing"
+)
+
+// OpenPTY skips the test: pseudo-terminals are only wired up on Linux.
+func OpenPTY(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+	t.Skip("pseudo-terminals not supported on this platform")
+	return nil, nil
+}